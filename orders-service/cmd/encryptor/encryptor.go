@@ -0,0 +1,73 @@
+// Command encryptor encrypts the PII of orders stored before PII_KEY_FILE
+// was set, in batches, with the same configuration as the service:
+//
+//	PII_KEY_FILE=./keys.json go run ./orders-service/cmd/encryptor -batch 500
+//
+// It only touches plaintext values and can be run again after a failure.
+// With -genkey it instead prints a new master key for the key file.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/fieldcrypt"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure/postgres"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func main() {
+	batch := flag.Int("batch", 500, "rows encrypted per transaction")
+	genkey := flag.Bool("genkey", false, "print a new base64 master key and exit")
+	flag.Parse()
+
+	if *genkey {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("generate key: %v", err)
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := config.Load()
+	if cfg.Privacy.KeyFile == "" {
+		log.Fatal("PII_KEY_FILE is not set")
+	}
+
+	keys, err := fieldcrypt.LoadKeyFile(cfg.Privacy.KeyFile)
+	if err != nil {
+		log.Fatalf("load key file: %v", err)
+	}
+
+	pool, err := pgxpool.New(ctx, cfg.Postgres.DSN())
+	if err != nil {
+		log.Fatalf("connect to postgres: %v", err)
+	}
+	defer pool.Close()
+
+	repo := postgres.NewOrderRepository(pool, fieldcrypt.NewEncryptor(keys))
+
+	total := make(map[string]int)
+	err = repo.EncryptExisting(ctx, *batch, func(table string, n int) {
+		total[table] += n
+		log.Printf("encrypted %d rows of %s (%d so far)\n", n, table, total[table])
+	})
+	if err != nil {
+		log.Fatalf("encryption failed: %v", err)
+	}
+
+	log.Printf("encryption done: delivery=%d payment=%d order_revisions=%d\n",
+		total["delivery"], total["payment"], total["order_revisions"])
+}
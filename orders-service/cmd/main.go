@@ -4,12 +4,16 @@ import (
 	"context"
 	"errors"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/app"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/auth"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/delivery"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/fieldcrypt"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure/postgres"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/kafka"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/metrics"
 	oc "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/order-cache"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/privacy"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/service"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/validation"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/logger"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -24,6 +28,10 @@ import (
 	"go.uber.org/zap"
 )
 
+// listenReadyTimeout bounds how long startup waits for the order change
+// listener before warming up the cache without it.
+const listenReadyTimeout = 10 * time.Second
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -59,19 +67,63 @@ func main() {
 		zap.String("db", cfg.Postgres.DBName),
 	)
 
-	repository := postgres.NewOrderRepository(dbpool)
-	c := oc.NewOrderCache(cfg.Cache)
+	var enc *fieldcrypt.Encryptor
+	if cfg.Privacy.KeyFile != "" {
+		keys, err := fieldcrypt.LoadKeyFile(cfg.Privacy.KeyFile)
+		if err != nil {
+			log.Fatal("cannot load PII key file", zap.Error(err))
+		}
+		enc = fieldcrypt.NewEncryptor(keys)
+	} else {
+		log.Warn("PII_KEY_FILE not set, PII is stored in plaintext")
+	}
+
+	repository := postgres.NewOrderRepository(dbpool, enc)
 
 	reg := prometheus.NewRegistry()
 	met := metrics.New(reg)
 
-	svc := service.New(repository, c, log, cfg.Cache.Limit, met)
+	c := oc.New(cfg.Cache, met)
+
+	svc := service.New(repository, c, log, cfg.Cache, met, validation.Default(cfg.Validation.Currencies...), enc)
+
+	// listen before warming up so that no change made meanwhile is missed
+	if cfg.Cache.Invalidate {
+		listener := postgres.NewOrderListener(dbpool, log)
+		go func() {
+			err := listener.Listen(ctx, svc.InvalidateOrder, func() { go svc.ResyncCache(ctx) })
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Error("order change listener stopped", zap.Error(err))
+			}
+		}()
+
+		select {
+		case <-listener.Ready():
+		case <-ctx.Done():
+		case <-time.After(listenReadyTimeout):
+			// changes made during warmup may be missed, catch up once listening
+			log.Warn("order change listener not ready, warming up without it")
+			go func() {
+				select {
+				case <-listener.Ready():
+					svc.ResyncCache(ctx)
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}
 
-	if err := svc.WarmupCache(ctx); err != nil {
+	if cfg.Cache.WarmupAsync {
+		go func() {
+			if err := svc.LoadCache(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Error("background cache warmup failed", zap.Error(err))
+			}
+		}()
+	} else if err := svc.LoadCache(ctx); err != nil {
 		log.Fatal("warmup cache failed", zap.Error(err))
 	}
 
-	cons := consumer.New(cfg.Kafka, svc, log)
+	cons := consumer.New(cfg.Kafka, svc, log, met)
 	defer cons.Close()
 
 	go func() {
@@ -81,12 +133,34 @@ func main() {
 		}
 	}()
 
-	handler := delivery.NewOrderHandler(svc)
+	var authn *delivery.Authenticator
+	if cfg.Auth.Enabled {
+		authn = delivery.NewAuthenticator(newVerifier(cfg.Auth), met)
+	} else {
+		log.Warn("authentication disabled, all routes are open")
+	}
+
+	piiPolicy, err := privacy.ParsePolicy(privacy.DefaultPolicy(), cfg.Privacy.PIIPolicy)
+	if err != nil {
+		log.Fatal("invalid PII_POLICY", zap.Error(err))
+	}
+
+	handler := delivery.NewOrderHandler(svc, authn, piiPolicy)
 	mux := http.NewServeMux()
 	handler.RegisterRoutes(mux)
 
-	mux.Handle("/", http.FileServer(http.Dir("../web")))
-	mux.Handle("GET /metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	if authn != nil {
+		delivery.NewAdminHandler(svc, authn).RegisterRoutes(mux)
+	} else {
+		log.Info("admin routes disabled, they require authentication")
+	}
+
+	// The static UI and /health are deliberately exempt from authentication.
+	// The UI files hold no order data, and a browser cannot attach a bearer
+	// token when it navigates to a page; the UI asks for a token instead and
+	// sends it with every API call, which is checked like any other client's.
+	mux.Handle("GET /", http.FileServer(http.Dir("../web")))
+	mux.Handle("GET /metrics", authn.Require(auth.PermReadMetrics, promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
 
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -95,12 +169,15 @@ func main() {
 
 	srv := &http.Server{
 		Addr:         cfg.HTTP.Addr,
-		Handler:      mux,
+		Handler:      delivery.RequestID(mux),
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 5 * time.Second,
 	}
 
 	application := app.NewApp(srv, log, &cfg)
+	if cfg.Cache.Snapshot != "" {
+		application.OnShutdown(svc.SaveCacheSnapshot)
+	}
 
 	if err := application.Start(ctx); err != nil {
 		log.Error("application error", zap.Error(err))
@@ -110,3 +187,13 @@ func main() {
 		log.Error("graceful shutdown failed", zap.Error(err))
 	}
 }
+
+// newVerifier accepts tokens signed with a key of the user-service JWKS,
+// plus the static metrics token.
+func newVerifier(cfg config.AuthConfig) auth.Verifier {
+	var v auth.Verifier = auth.NewJWKSVerifier(cfg.JWKSURL, cfg.Issuer)
+	if cfg.MetricsToken != "" {
+		v = auth.Chain(auth.NewStaticVerifier(cfg.MetricsToken, "metrics", auth.RoleMetricsScraper), v)
+	}
+	return v
+}
@@ -14,6 +14,7 @@ type App struct {
 	srv    *http.Server
 	logger *zap.Logger
 	cfg    *config.Config
+	hooks  []func() error
 }
 
 func NewApp(srv *http.Server, logger *zap.Logger, cfg *config.Config) *App {
@@ -24,6 +25,12 @@ func NewApp(srv *http.Server, logger *zap.Logger, cfg *config.Config) *App {
 	}
 }
 
+// OnShutdown registers fn to be run by Shutdown once the HTTP server has
+// stopped.
+func (a *App) OnShutdown(fn func() error) {
+	a.hooks = append(a.hooks, fn)
+}
+
 func (a *App) Start(ctx context.Context) error {
 	errChan := make(chan error, 1)
 
@@ -51,11 +58,18 @@ func (a *App) Shutdown() error {
 
 	a.logger.Info("shutting down HTTP server")
 
+	var errs []error
 	if err := a.srv.Shutdown(ctx); err != nil {
 		a.logger.Error("failed to shutdown HTTP server", zap.Error(err))
-		return err
+		errs = append(errs, err)
+	} else {
+		a.logger.Info("HTTP server stopped")
 	}
 
-	a.logger.Info("HTTP server stopped")
-	return nil
+	for _, fn := range a.hooks {
+		if err := fn(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// jwksMaxAge is how long fetched keys are used before they are refetched.
+	jwksMaxAge = 10 * time.Minute
+	// jwksMinRefresh limits refetches caused by tokens with an unknown kid.
+	jwksMinRefresh = 30 * time.Second
+	jwksTimeout    = 5 * time.Second
+)
+
+// ErrJWKSUnavailable is returned when keys are needed but cannot be fetched;
+// the token may well be valid.
+var ErrJWKSUnavailable = errors.New("jwks unavailable")
+
+// JWKSVerifier accepts RS256 and EdDSA tokens signed by any key published at
+// a JWKS URL, so that tokens are verified without calling user-service.
+// Keys are cached and refetched when they get old or a token names an
+// unknown kid, which is how rotated keys are picked up.
+type JWKSVerifier struct {
+	url    string
+	issuer string
+	client *http.Client
+	// fetches makes concurrent requests needing new keys share one fetch,
+	// which runs without holding mu.
+	fetches singleflight.Group
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func NewJWKSVerifier(url, issuer string) *JWKSVerifier {
+	return &JWKSVerifier{
+		url:    url,
+		issuer: issuer,
+		client: &http.Client{Timeout: jwksTimeout},
+	}
+}
+
+func (v *JWKSVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	methods := []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+	return parse(token, v.issuer, methods, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	})
+}
+
+func (v *JWKSVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.keys[kid]
+	age := time.Since(v.fetched)
+	known := v.keys != nil
+	v.mu.Unlock()
+
+	if ok && age < jwksMaxAge {
+		return key, nil
+	}
+	if !ok && known && age < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+
+	keys, err := v.refresh(ctx)
+	if err != nil {
+		if ok {
+			// keep verifying with known keys while the JWKS is unreachable
+			return key, nil
+		}
+		return nil, fmt.Errorf("%w: %w", ErrJWKSUnavailable, err)
+	}
+
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+// refresh fetches the keys and swaps them in. The fetch is detached from the
+// caller that started it, so that one canceled request does not fail the
+// others waiting for it.
+func (v *JWKSVerifier) refresh(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	ch := v.fetches.DoChan("", func() (any, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksTimeout)
+		defer cancel()
+
+		keys, err := v.fetch(fetchCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		v.mu.Lock()
+		v.keys, v.fetched = keys, time.Now()
+		v.mu.Unlock()
+		return keys, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(map[string]crypto.PublicKey), nil
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+func (v *JWKSVerifier) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", v.url, resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		pub, err := k.publicKey()
+		if err != nil {
+			// skip keys we cannot use rather than failing on all of them
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	dec := base64.RawURLEncoding.DecodeString
+
+	switch {
+	case k.Kty == "RSA":
+		n, err := dec(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := dec(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := dec(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type testKey struct {
+	kid  string
+	priv ed25519.PrivateKey
+}
+
+func newTestKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, priv: priv}
+}
+
+func (k testKey) sign(t *testing.T) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, Claims{
+		Role: "user",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "user-service",
+			Subject:   "alice",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	tok.Header["kid"] = k.kid
+	s, err := tok.SignedString(k.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// jwksServer publishes the keys it is given, which can be changed to
+// simulate rotation, and counts fetches.
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []testKey
+	fetches int
+	block   chan struct{}
+}
+
+func newJWKSServer(t *testing.T, keys ...testKey) *jwksServer {
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		s.fetches++
+		block := s.block
+		set := struct {
+			Keys []jwk `json:"keys"`
+		}{}
+		for _, k := range s.keys {
+			pub := k.priv.Public().(ed25519.PublicKey)
+			set.Keys = append(set.Keys, jwk{Kty: "OKP", Crv: "Ed25519", Kid: k.kid, X: base64.RawURLEncoding.EncodeToString(pub)})
+		}
+		s.mu.Unlock()
+
+		if block != nil {
+			<-block
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) publish(keys ...testKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func TestJWKSVerifierKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	k1, k2 := newTestKey(t, "k1"), newTestKey(t, "k2")
+
+	tests := []struct {
+		name string
+		// published are the keys the JWKS serves when the token is verified;
+		// age is how long ago the verifier fetched the keys it has.
+		published []testKey
+		age       time.Duration
+		signer    testKey
+		wantErr   error
+	}{
+		{"known key", []testKey{k1}, 0, k1, nil},
+		{"new key refetched", []testKey{k1, k2}, jwksMinRefresh, k2, nil},
+		{"new key within refetch limit", []testKey{k1, k2}, 0, k2, ErrInvalidToken},
+		{"old key still published", []testKey{k1, k2}, jwksMaxAge, k1, nil},
+		{"old key retired", []testKey{k2}, jwksMaxAge, k1, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newJWKSServer(t, k1)
+			v := NewJWKSVerifier(srv.URL, "user-service")
+			if _, err := v.Verify(ctx, k1.sign(t)); err != nil {
+				t.Fatalf("initial verify: %v", err)
+			}
+
+			srv.publish(tt.published...)
+			v.mu.Lock()
+			v.fetched = v.fetched.Add(-tt.age)
+			v.mu.Unlock()
+
+			claims, err := v.Verify(ctx, tt.signer.sign(t))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verify error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Subject != "alice" {
+				t.Fatalf("subject = %q", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestJWKSVerifierUnavailable(t *testing.T) {
+	srv := newJWKSServer(t)
+	srv.Close()
+
+	v := NewJWKSVerifier(srv.URL, "user-service")
+	_, err := v.Verify(context.Background(), newTestKey(t, "k1").sign(t))
+	if !errors.Is(err, ErrJWKSUnavailable) {
+		t.Fatalf("verify error = %v, want %v", err, ErrJWKSUnavailable)
+	}
+}
+
+func TestJWKSVerifierFetchDoesNotBlockKnownKeys(t *testing.T) {
+	ctx := context.Background()
+	k1, k2 := newTestKey(t, "k1"), newTestKey(t, "k2")
+
+	srv := newJWKSServer(t, k1)
+	v := NewJWKSVerifier(srv.URL, "user-service")
+	if _, err := v.Verify(ctx, k1.sign(t)); err != nil {
+		t.Fatalf("initial verify: %v", err)
+	}
+
+	// hang the next fetches, which tokens signed with the new key trigger
+	block := make(chan struct{})
+	srv.mu.Lock()
+	srv.keys, srv.block = []testKey{k1, k2}, block
+	srv.mu.Unlock()
+	v.mu.Lock()
+	v.fetched = v.fetched.Add(-jwksMinRefresh)
+	v.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(ctx, k2.sign(t)); err != nil {
+				t.Errorf("verify with new key: %v", err)
+			}
+		}()
+	}
+
+	// wait for the fetch to start
+	for {
+		srv.mu.Lock()
+		n := srv.fetches
+		srv.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := v.Verify(ctx, k1.sign(t))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("verify with known key: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("verify with known key blocked behind the fetch")
+	}
+
+	close(block)
+	wg.Wait()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.fetches != 2 {
+		t.Fatalf("fetches = %d, want 2: concurrent refreshes were not shared", srv.fetches)
+	}
+}
+
+func TestJWKSVerifierRejectsHMACTokens(t *testing.T) {
+	ctx := context.Background()
+	k := newTestKey(t, "k1")
+	srv := newJWKSServer(t, k)
+	v := NewJWKSVerifier(srv.URL, "user-service")
+
+	// an HS256 token keyed with the published public key, which a verifier
+	// trusting the alg header would accept
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role: "admin",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "user-service",
+			Subject:   "mallory",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	tok.Header["kid"] = k.kid
+	forged, err := tok.SignedString([]byte(k.priv.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Verify(ctx, forged); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("verify error = %v, want %v", err, ErrInvalidToken)
+	}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"slices"
+	"strings"
+)
+
+type Permission string
+
+const (
+	PermReadOrders  Permission = "orders:read"
+	PermManageCache Permission = "cache:manage"
+	PermReadMetrics Permission = "metrics:read"
+	// PermReadPII allows seeing customer contact and payment details
+	// unmasked.
+	PermReadPII Permission = "pii:read"
+)
+
+// RoleMetricsScraper is the role of the static metrics token; it is not a
+// user role.
+const RoleMetricsScraper entity.UserRole = "metrics"
+
+var rolePermissions = map[entity.UserRole][]Permission{
+	entity.UserRoleUser:  {PermReadOrders},
+	entity.UserRoleAdmin: {PermReadOrders, PermReadPII, PermManageCache, PermReadMetrics},
+	RoleMetricsScraper:   {PermReadMetrics},
+}
+
+// Allowed reports whether role grants perm.
+func Allowed(role entity.UserRole, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the token grants perm, through its role or its
+// space-separated scope claim.
+func (c *Claims) Can(perm Permission) bool {
+	if c == nil {
+		return false
+	}
+	return Allowed(c.Role, perm) || slices.Contains(strings.Fields(c.Scope), string(perm))
+}
@@ -0,0 +1,99 @@
+package delivery
+
+import (
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/auth"
+	oc "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/order-cache"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	CodeWarmupRunning  = "warmup_running"
+	CodeOrderNotCached = "order_not_cached"
+)
+
+const maxWarmupLimit = 1_000_000
+
+type AdminService interface {
+	CacheStats() oc.Stats
+	EvictOrder(id string) bool
+	FlushCache() int
+	StartWarmup(limit int) error
+}
+
+// AdminHandler serves the /admin routes, which require the cache:manage
+// permission.
+type AdminHandler struct {
+	svc   AdminService
+	authn *Authenticator
+}
+
+func NewAdminHandler(svc AdminService, authn *Authenticator) *AdminHandler {
+	return &AdminHandler{svc: svc, authn: authn}
+}
+
+func (h *AdminHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("GET /admin/cache", h.authn.Require(auth.PermManageCache, http.HandlerFunc(h.GetCacheStats)))
+	mux.Handle("DELETE /admin/cache/{id}", h.authn.Require(auth.PermManageCache, http.HandlerFunc(h.EvictOrder)))
+	mux.Handle("POST /admin/cache/flush", h.authn.Require(auth.PermManageCache, http.HandlerFunc(h.FlushCache)))
+	mux.Handle("POST /admin/cache/warmup", h.authn.Require(auth.PermManageCache, http.HandlerFunc(h.WarmupCache)))
+}
+
+type cacheStatsResponse struct {
+	oc.Stats
+	HitRatio  float64 `json:"hit_ratio"`
+	OldestAge string  `json:"oldest_age,omitempty"`
+}
+
+func (h *AdminHandler) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	st := h.svc.CacheStats()
+	resp := cacheStatsResponse{Stats: st, HitRatio: st.HitRatio()}
+	if st.Oldest != nil {
+		resp.OldestAge = time.Since(st.Oldest.CachedAt).Round(time.Second).String()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *AdminHandler) EvictOrder(w http.ResponseWriter, r *http.Request) {
+	id, ok := orderID(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.svc.EvictOrder(id) {
+		writeError(w, r, http.StatusNotFound, CodeOrderNotCached, "order is not cached")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) FlushCache(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]int{"evicted": h.svc.FlushCache()})
+}
+
+// WarmupCache starts a warmup of up to ?limit= orders, the configured cache
+// limit by default, and returns without waiting for it.
+func (h *AdminHandler) WarmupCache(w http.ResponseWriter, r *http.Request) {
+	limit := h.svc.CacheStats().Limit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxWarmupLimit {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "limit must be between 1 and "+strconv.Itoa(maxWarmupLimit))
+			return
+		}
+		limit = n
+	}
+
+	if err := h.svc.StartWarmup(limit); err != nil {
+		if errors.Is(err, service.ErrWarmupRunning) {
+			writeError(w, r, http.StatusConflict, CodeWarmupRunning, "cache warmup already running")
+			return
+		}
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]int{"limit": limit})
+}
@@ -0,0 +1,84 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/auth"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/metrics"
+	"net/http"
+	"strings"
+)
+
+// Outcomes of an authorization check reported in metrics.
+const (
+	authAllowed         = "allowed"
+	authUnauthenticated = "unauthenticated"
+	authForbidden       = "forbidden"
+	authUnavailable     = "unavailable"
+)
+
+type claimsKey struct{}
+
+// Authenticator guards routes with bearer access tokens. A nil
+// *Authenticator lets every request through.
+type Authenticator struct {
+	verifier auth.Verifier
+	met      *metrics.Metrics
+}
+
+func NewAuthenticator(v auth.Verifier, met *metrics.Metrics) *Authenticator {
+	return &Authenticator{verifier: v, met: met}
+}
+
+// Require lets through requests whose token grants perm, answering 401 to
+// requests without a valid token and 403 to those lacking the permission.
+func (a *Authenticator) Require(perm auth.Permission, next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			a.count(perm, authUnauthenticated)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "access token required")
+			return
+		}
+
+		claims, err := a.verifier.Verify(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, auth.ErrJWKSUnavailable) {
+				a.count(perm, authUnavailable)
+				writeError(w, r, http.StatusServiceUnavailable, CodeAuthUnavailable, "cannot verify access token")
+				return
+			}
+			a.count(perm, authUnauthenticated)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "invalid access token")
+			return
+		}
+
+		if !claims.Can(perm) {
+			a.count(perm, authForbidden)
+			writeError(w, r, http.StatusForbidden, CodeForbidden, "permission "+string(perm)+" required")
+			return
+		}
+
+		a.count(perm, authAllowed)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	})
+}
+
+func (a *Authenticator) count(perm auth.Permission, result string) {
+	if a.met != nil {
+		a.met.AuthRequests.WithLabelValues(string(perm), result).Inc()
+	}
+}
+
+// ClaimsFromContext returns the claims of the token the request was
+// authorized with, if any.
+func ClaimsFromContext(ctx context.Context) (*auth.Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(*auth.Claims)
+	return c, ok
+}
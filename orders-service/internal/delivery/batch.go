@@ -0,0 +1,60 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"net/http"
+)
+
+const maxBatchIDs = 100
+
+type batchRequest struct {
+	OrderUIDs []string `json:"order_uids"`
+}
+
+type batchResponse struct {
+	Orders  []entity.Order `json:"orders"`
+	Missing []string       `json:"missing"`
+}
+
+// GetOrdersBatch looks up to maxBatchIDs orders at once and reports the ids
+// that do not exist.
+func (h *OrderHandler) GetOrdersBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "bad json")
+		return
+	}
+
+	if len(req.OrderUIDs) == 0 {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "order_uids must not be empty")
+		return
+	}
+
+	seen := make(map[string]struct{}, len(req.OrderUIDs))
+	ids := make([]string, 0, len(req.OrderUIDs))
+	for _, id := range req.OrderUIDs {
+		if !orderIDRe.MatchString(id) {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidOrderID, fmt.Sprintf("malformed order id %q", id))
+			return
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	if len(ids) > maxBatchIDs {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("at most %d order_uids are allowed", maxBatchIDs))
+		return
+	}
+
+	orders, missing, err := h.os.GetOrders(r.Context(), ids)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, batchResponse{Orders: h.projectOrders(r, orders), Missing: missing})
+}
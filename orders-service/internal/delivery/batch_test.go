@@ -0,0 +1,118 @@
+package delivery
+
+import (
+	"fmt"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetOrdersBatch(t *testing.T) {
+	ids := func(n int) []string {
+		s := make([]string, n)
+		for i := range s {
+			s[i] = fmt.Sprintf("id%d", i)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		body       any
+		wantStatus int
+		// wantLookup is the ids looked up; wantFound and wantMissing the
+		// ids in the response.
+		wantLookup  []string
+		wantFound   []string
+		wantMissing []string
+	}{
+		{
+			name:        "all found",
+			body:        batchRequest{OrderUIDs: []string{"a", "b"}},
+			wantStatus:  http.StatusOK,
+			wantLookup:  []string{"a", "b"},
+			wantFound:   []string{"a", "b"},
+			wantMissing: []string{},
+		},
+		{
+			name:        "some missing",
+			body:        batchRequest{OrderUIDs: []string{"x", "a", "y"}},
+			wantStatus:  http.StatusOK,
+			wantLookup:  []string{"x", "a", "y"},
+			wantFound:   []string{"a"},
+			wantMissing: []string{"x", "y"},
+		},
+		{
+			name:        "duplicates looked up once",
+			body:        batchRequest{OrderUIDs: []string{"a", "x", "a", "x", "b"}},
+			wantStatus:  http.StatusOK,
+			wantLookup:  []string{"a", "x", "b"},
+			wantFound:   []string{"a", "b"},
+			wantMissing: []string{"x"},
+		},
+		{
+			name:        "limit",
+			body:        batchRequest{OrderUIDs: ids(maxBatchIDs)},
+			wantStatus:  http.StatusOK,
+			wantLookup:  ids(maxBatchIDs),
+			wantMissing: ids(maxBatchIDs),
+		},
+		{
+			name:        "duplicates do not count towards the limit",
+			body:        batchRequest{OrderUIDs: append(ids(maxBatchIDs), "id0", "id1")},
+			wantStatus:  http.StatusOK,
+			wantLookup:  ids(maxBatchIDs),
+			wantMissing: ids(maxBatchIDs),
+		},
+		{
+			name:       "over the limit",
+			body:       batchRequest{OrderUIDs: ids(maxBatchIDs + 1)},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "empty",
+			body:       batchRequest{OrderUIDs: []string{}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "malformed id",
+			body:       batchRequest{OrderUIDs: []string{"a", "a/../b"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bad json",
+			body:       "a,b",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, svc := newTestHandler(entity.Order{OrderUID: "a"}, entity.Order{OrderUID: "b"})
+
+			rec := serve(t, h, http.MethodPost, "/orders/batch", userToken, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if len(svc.lookups) > 0 {
+					t.Fatalf("looked up %v", svc.lookups)
+				}
+				return
+			}
+
+			if len(svc.lookups) != 1 || !reflect.DeepEqual(svc.lookups[0], tt.wantLookup) {
+				t.Fatalf("lookups = %v, want %v", svc.lookups, tt.wantLookup)
+			}
+			resp := decode[batchResponse](t, rec)
+			var found []string
+			for _, o := range resp.Orders {
+				found = append(found, o.OrderUID)
+			}
+			if !reflect.DeepEqual(found, tt.wantFound) || !reflect.DeepEqual(resp.Missing, tt.wantMissing) {
+				t.Fatalf("found %v, missing %v; want %v, %v", found, resp.Missing, tt.wantFound, tt.wantMissing)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure"
+	"net/http"
+	"regexp"
+)
+
+// StatusClientClosedRequest is reported when the client went away before the
+// response was ready.
+const StatusClientClosedRequest = 499
+
+const (
+	CodeBadRequest          = "bad_request"
+	CodeInvalidOrderID      = "invalid_order_id"
+	CodeOrderNotFound       = "order_not_found"
+	CodeRevisionNotFound    = "revision_not_found"
+	CodeDatabaseUnavailable = "database_unavailable"
+	CodeRequestCanceled     = "request_canceled"
+	CodeTimeout             = "timeout"
+	CodeInternal            = "internal_error"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeAuthUnavailable     = "auth_unavailable"
+)
+
+var orderIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type errorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, msg string) {
+	writeJSON(w, status, errorResponse{Error: errorBody{
+		Code:      code,
+		Message:   msg,
+		RequestID: RequestIDFromContext(r.Context()),
+	}})
+}
+
+// writeServiceError maps an error returned by the OrderService to a status
+// and error code.
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, infrastructure.ErrOrderNotFound):
+		writeError(w, r, http.StatusNotFound, CodeOrderNotFound, "order not found")
+	case errors.Is(err, infrastructure.ErrRevisionNotFound):
+		writeError(w, r, http.StatusNotFound, CodeRevisionNotFound, "revision not found")
+	case errors.Is(err, context.Canceled):
+		writeError(w, r, StatusClientClosedRequest, CodeRequestCanceled, "request canceled")
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, r, http.StatusGatewayTimeout, CodeTimeout, "request timed out")
+	case errors.Is(err, infrastructure.ErrInternalDatabase):
+		writeError(w, r, http.StatusServiceUnavailable, CodeDatabaseUnavailable, "database unavailable")
+	default:
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "internal error")
+	}
+}
+
+// orderID returns the {id} path value if it is a well-formed order_uid and
+// writes a 400 response otherwise.
+func orderID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if !orderIDRe.MatchString(id) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidOrderID, "malformed order id")
+		return "", false
+	}
+	return id, true
+}
@@ -2,41 +2,58 @@ package delivery
 
 import (
 	"context"
-	"encoding/json"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/auth"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/privacy"
 	"net/http"
 )
 
 type OrderService interface {
-	SaveOrderFromEvent(ctx context.Context, msg []byte) error
+	SaveOrderFromEvent(ctx context.Context, ev entity.OrderEvent) error
+	SaveOrdersFromEvents(ctx context.Context, evs []entity.OrderEvent) ([]error, error)
 	GetOrder(ctx context.Context, id string) (*entity.Order, error)
+	GetOrders(ctx context.Context, ids []string) ([]entity.Order, []string, error)
+	SearchOrders(ctx context.Context, f entity.OrderFilter) (*entity.OrderPage, error)
+
+	OrderHistory(ctx context.Context, id string) ([]entity.OrderRevision, error)
+	OrderRevision(ctx context.Context, id string, revID int64) (*entity.OrderRevision, error)
+	DiffRevisions(ctx context.Context, id string, fromID, toID int64) ([]entity.FieldChange, error)
 }
 
 type OrderHandler struct {
-	os OrderService
+	os    OrderService
+	authn *Authenticator
+	pii   privacy.Policy
 }
 
-func NewOrderHandler(os OrderService) *OrderHandler {
-	return &OrderHandler{os: os}
+// NewOrderHandler returns a handler that projects customer PII in responses
+// by pii unless the caller may read it.
+func NewOrderHandler(os OrderService, authn *Authenticator, pii privacy.Policy) *OrderHandler {
+	return &OrderHandler{os: os, authn: authn, pii: pii}
 }
 
 func (h *OrderHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("GET /order/{id}", h.GetOrderInfo)
+	read := func(fn http.HandlerFunc) http.Handler {
+		return h.authn.Require(auth.PermReadOrders, fn)
+	}
+	mux.Handle("GET /order/{id}", read(h.GetOrderInfo))
+	mux.Handle("GET /orders", read(h.ListOrders))
+	mux.Handle("POST /orders/batch", read(h.GetOrdersBatch))
+	mux.Handle("GET /order/{id}/history", read(h.GetOrderHistory))
+	mux.Handle("GET /order/{id}/history/{rev}", read(h.GetOrderRevision))
 }
 
 func (h *OrderHandler) GetOrderInfo(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	if id == "" {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	id, ok := orderID(w, r)
+	if !ok {
 		return
 	}
 
 	o, err := h.os.GetOrder(r.Context(), id)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		writeServiceError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	_ = json.NewEncoder(w).Encode(o)
+	writeJSON(w, http.StatusOK, h.projectOrder(r, o))
 }
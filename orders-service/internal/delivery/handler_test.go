@@ -0,0 +1,110 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/auth"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/privacy"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Access tokens accepted by newTestHandler.
+const (
+	userToken  = "user-token"
+	adminToken = "admin-token"
+)
+
+// fakeOrders serves the orders it holds, newest first by date_created.
+type fakeOrders struct {
+	OrderService
+	orders []entity.Order
+	// filters are the filters SearchOrders was called with.
+	filters []entity.OrderFilter
+	// lookups are the ids GetOrders was called with.
+	lookups [][]string
+}
+
+func (f *fakeOrders) GetOrders(_ context.Context, ids []string) ([]entity.Order, []string, error) {
+	f.lookups = append(f.lookups, ids)
+	var found []entity.Order
+	missing := []string{}
+	for _, id := range ids {
+		i := f.index(id)
+		if i < 0 {
+			missing = append(missing, id)
+			continue
+		}
+		found = append(found, f.orders[i])
+	}
+	return found, missing, nil
+}
+
+func (f *fakeOrders) SearchOrders(_ context.Context, filter entity.OrderFilter) (*entity.OrderPage, error) {
+	f.filters = append(f.filters, filter)
+
+	start := 0
+	if filter.After != nil {
+		start = f.index(filter.After.OrderUID) + 1
+	}
+	end := min(start+filter.Limit, len(f.orders))
+	page := &entity.OrderPage{Orders: f.orders[start:end]}
+	if end < len(f.orders) {
+		last := f.orders[end-1]
+		page.Next = &entity.OrderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID}
+	}
+	return page, nil
+}
+
+func (f *fakeOrders) index(id string) int {
+	for i, o := range f.orders {
+		if o.OrderUID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// newTestHandler serves orders with the default privacy policy to callers
+// presenting userToken or adminToken.
+func newTestHandler(orders ...entity.Order) (http.Handler, *fakeOrders) {
+	svc := &fakeOrders{orders: orders}
+	authn := NewAuthenticator(auth.Chain(
+		auth.NewStaticVerifier(userToken, "alice", entity.UserRoleUser),
+		auth.NewStaticVerifier(adminToken, "root", entity.UserRoleAdmin),
+	), nil)
+
+	mux := http.NewServeMux()
+	NewOrderHandler(svc, authn, privacy.DefaultPolicy()).RegisterRoutes(mux)
+	return mux, svc
+}
+
+func serve(t *testing.T, h http.Handler, method, target, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, target, r)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return v
+}
@@ -0,0 +1,83 @@
+package delivery
+
+import (
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"net/http"
+	"strconv"
+)
+
+type historyResponse struct {
+	OrderUID  string                 `json:"order_uid"`
+	Revisions []entity.OrderRevision `json:"revisions"`
+}
+
+type diffResponse struct {
+	OrderUID string               `json:"order_uid"`
+	From     int64                `json:"from"`
+	To       int64                `json:"to"`
+	Changes  []entity.FieldChange `json:"changes"`
+}
+
+// GetOrderHistory lists the revisions of an order. With both the from and to
+// query parameters set to revision ids it returns the field-level diff
+// between those revisions instead.
+func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := orderID(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Has("from") || q.Has("to") {
+		from, errFrom := strconv.ParseInt(q.Get("from"), 10, 64)
+		to, errTo := strconv.ParseInt(q.Get("to"), 10, 64)
+		if errFrom != nil || errTo != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "from and to must be revision ids")
+			return
+		}
+
+		changes, err := h.os.DiffRevisions(r.Context(), id, from, to)
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		changes = h.privacyPolicy(r).Changes(changes)
+		writeJSON(w, http.StatusOK, diffResponse{OrderUID: id, From: from, To: to, Changes: changes})
+		return
+	}
+
+	revs, err := h.os.OrderHistory(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	for i := range revs {
+		revs[i].Version = entity.ProducerVersion(revs[i].Version)
+	}
+	writeJSON(w, http.StatusOK, historyResponse{OrderUID: id, Revisions: revs})
+}
+
+// GetOrderRevision returns the order as it was stored by one revision.
+func (h *OrderHandler) GetOrderRevision(w http.ResponseWriter, r *http.Request) {
+	id, ok := orderID(w, r)
+	if !ok {
+		return
+	}
+	revID, err := strconv.ParseInt(r.PathValue("rev"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "malformed revision id")
+		return
+	}
+
+	rev, err := h.os.OrderRevision(r.Context(), id, revID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	rev.Version = entity.ProducerVersion(rev.Version)
+	rev.Order = h.projectOrder(r, rev.Order)
+	writeJSON(w, http.StatusOK, rev)
+}
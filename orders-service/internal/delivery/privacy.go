@@ -0,0 +1,40 @@
+package delivery
+
+import (
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/auth"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/privacy"
+	"net/http"
+)
+
+// privacyPolicy returns the projection of PII for the caller of r: nothing
+// is hidden from callers allowed to read PII, and everybody else, including
+// unauthenticated callers when auth is disabled, gets the handler policy.
+func (h *OrderHandler) privacyPolicy(r *http.Request) privacy.Policy {
+	claims, _ := ClaimsFromContext(r.Context())
+	if claims.Can(auth.PermReadPII) {
+		return nil
+	}
+	return h.pii
+}
+
+// projectOrder returns o as shown to the caller of r: with PII projected and
+// without a version taken from the broker, which means nothing to clients.
+func (h *OrderHandler) projectOrder(r *http.Request, o *entity.Order) *entity.Order {
+	if o == nil {
+		return nil
+	}
+	p := h.privacyPolicy(r).Order(*o)
+	p.Version = entity.ProducerVersion(p.Version)
+	return &p
+}
+
+func (h *OrderHandler) projectOrders(r *http.Request, orders []entity.Order) []entity.Order {
+	policy := h.privacyPolicy(r)
+	out := make([]entity.Order, len(orders))
+	for i := range orders {
+		out[i] = policy.Order(orders[i])
+		out[i].Version = entity.ProducerVersion(out[i].Version)
+	}
+	return out
+}
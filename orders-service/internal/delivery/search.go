@@ -0,0 +1,130 @@
+package delivery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/auth"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const maxListLimit = 500
+
+// piiFilters maps the query parameters that filter on PII to the fields they
+// match. Filtering on a field the caller cannot see would reveal it.
+var piiFilters = map[string]string{
+	"bank":     "payment.bank",
+	"provider": "payment.provider",
+}
+
+type listResponse struct {
+	Orders     []entity.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// ListOrders returns orders matching the query filters, newest first unless
+// sort=date_created is given. Further pages are requested by passing the
+// returned next_cursor as cursor.
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	policy := h.privacyPolicy(r)
+	for param, field := range piiFilters {
+		if q.Get(param) != "" && policy.Restricts(field) {
+			writeError(w, r, http.StatusForbidden, CodeForbidden, "filtering by "+param+" requires permission "+string(auth.PermReadPII))
+			return
+		}
+	}
+
+	f, err := parseOrderFilter(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.os.SearchOrders(r.Context(), f)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	resp := listResponse{Orders: h.projectOrders(r, page.Orders)}
+	if page.Next != nil {
+		resp.NextCursor = encodeCursor(page.Next)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseOrderFilter(q url.Values) (entity.OrderFilter, error) {
+	f := entity.OrderFilter{
+		CustomerID:      q.Get("customer_id"),
+		TrackNumber:     q.Get("track_number"),
+		DeliveryService: q.Get("delivery_service"),
+		Entry:           q.Get("entry"),
+		Locale:          q.Get("locale"),
+		Provider:        q.Get("provider"),
+		Bank:            q.Get("bank"),
+		Brand:           q.Get("brand"),
+		Limit:           50,
+	}
+
+	var err error
+	if v := q.Get("nm_id"); v != "" {
+		if f.NmID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, errors.New("nm_id must be an integer")
+		}
+	}
+	if v := q.Get("created_from"); v != "" {
+		if f.CreatedFrom, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, errors.New("created_from must be an RFC 3339 time")
+		}
+	}
+	if v := q.Get("created_to"); v != "" {
+		if f.CreatedTo, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, errors.New("created_to must be an RFC 3339 time")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 || f.Limit > maxListLimit {
+			return f, errors.New("limit must be between 1 and " + strconv.Itoa(maxListLimit))
+		}
+	}
+
+	switch q.Get("sort") {
+	case "", "-date_created":
+	case "date_created":
+		f.Ascending = true
+	default:
+		return f, errors.New("sort must be date_created or -date_created")
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		if f.After, err = decodeCursor(v); err != nil {
+			return f, errors.New("malformed cursor")
+		}
+	}
+	return f, nil
+}
+
+func encodeCursor(c *entity.OrderCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*entity.OrderCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c entity.OrderCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if c.OrderUID == "" {
+		return nil, errors.New("empty cursor")
+	}
+	return &c, nil
+}
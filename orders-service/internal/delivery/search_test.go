@@ -0,0 +1,159 @@
+package delivery
+
+import (
+	"encoding/base64"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListOrdersPIIFilters(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		token      string
+		wantStatus int
+	}{
+		{"bank as user", "bank=alpha", userToken, http.StatusForbidden},
+		{"bank as admin", "bank=alpha", adminToken, http.StatusOK},
+		{"provider as user", "provider=wbpay", userToken, http.StatusOK},
+		{"shown field as user", "delivery_service=meest", userToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, svc := newTestHandler()
+
+			rec := serve(t, h, http.MethodGet, "/orders?"+tt.query, tt.token, nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if searched := len(svc.filters) > 0; searched != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("searched = %v with status %d", searched, rec.Code)
+			}
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 30, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		name string
+		c    entity.OrderCursor
+	}{
+		{"utc", entity.OrderCursor{DateCreated: ts, OrderUID: "b563feb7b2b84b6test"}},
+		{"other zone", entity.OrderCursor{DateCreated: ts.In(time.FixedZone("MSK", 3*60*60)), OrderUID: "a"}},
+		{"zero time", entity.OrderCursor{OrderUID: "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := encodeCursor(&tt.c)
+			if url.QueryEscape(s) != s {
+				t.Fatalf("cursor %q is not URL safe", s)
+			}
+			got, err := decodeCursor(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.OrderUID != tt.c.OrderUID || !got.DateCreated.Equal(tt.c.DateCreated) {
+				t.Fatalf("decoded %+v, want %+v", got, tt.c)
+			}
+		})
+	}
+}
+
+func TestListOrdersMalformedCursor(t *testing.T) {
+	valid := encodeCursor(&entity.OrderCursor{DateCreated: time.Now(), OrderUID: "a"})
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"u":"ab"}`))},
+		{"not json", b64([]byte("a"))},
+		{"wrong types", b64([]byte(`{"d":1,"u":"a"}`))},
+		{"no order id", b64([]byte(`{"d":"2026-03-01T00:00:00Z"}`))},
+		{"truncated", valid[:len(valid)-4]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, svc := newTestHandler()
+
+			rec := serve(t, h, http.MethodGet, "/orders?cursor="+url.QueryEscape(tt.cursor), userToken, nil)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+			if len(svc.filters) > 0 {
+				t.Fatal("searched with a malformed cursor")
+			}
+		})
+	}
+}
+
+func TestListOrdersPagesAreStable(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	// newest first, ties on date_created broken by order_uid
+	orders := []entity.Order{
+		{OrderUID: "g", DateCreated: ts.Add(3 * time.Hour)},
+		{OrderUID: "f", DateCreated: ts.Add(2 * time.Hour)},
+		{OrderUID: "e", DateCreated: ts.Add(time.Hour)},
+		{OrderUID: "d", DateCreated: ts.Add(time.Hour)},
+		{OrderUID: "c", DateCreated: ts.Add(time.Hour)},
+		{OrderUID: "b", DateCreated: ts},
+		{OrderUID: "a", DateCreated: ts.Add(-time.Hour)},
+	}
+
+	for _, limit := range []string{"1", "2", "3", "7", "10"} {
+		t.Run("limit "+limit, func(t *testing.T) {
+			h, svc := newTestHandler(orders...)
+
+			var got []string
+			cursor := ""
+			for page := 0; ; page++ {
+				if page > len(orders) {
+					t.Fatal("paging does not end")
+				}
+				q := url.Values{"customer_id": {"test"}, "limit": {limit}}
+				if cursor != "" {
+					q.Set("cursor", cursor)
+				}
+				rec := serve(t, h, http.MethodGet, "/orders?"+q.Encode(), userToken, nil)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("page %d: status = %d: %s", page, rec.Code, rec.Body)
+				}
+				resp := decode[listResponse](t, rec)
+				for _, o := range resp.Orders {
+					got = append(got, o.OrderUID)
+				}
+
+				f := svc.filters[page]
+				if f.CustomerID != "test" {
+					t.Fatalf("page %d: filter %+v lost customer_id", page, f)
+				}
+				if page > 0 {
+					prev := orders[len(got)-len(resp.Orders)-1]
+					if f.After == nil || f.After.OrderUID != prev.OrderUID || !f.After.DateCreated.Equal(prev.DateCreated) {
+						t.Fatalf("page %d: cursor %+v, want after %s at %s", page, f.After, prev.OrderUID, prev.DateCreated)
+					}
+				}
+
+				if resp.NextCursor == "" {
+					break
+				}
+				cursor = resp.NextCursor
+			}
+
+			if strings.Join(got, "") != "gfedcba" {
+				t.Fatalf("paged through %v, want every order once in order", got)
+			}
+		})
+	}
+}
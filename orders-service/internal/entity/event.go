@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// OrderEvent is a raw order message together with the Kafka coordinates it
+// was read from.
+type OrderEvent struct {
+	Payload   []byte
+	Topic     string
+	Partition int
+	Offset    int64
+	Timestamp time.Time
+}
+
+// OrderChange tells that an order was stored with the given version.
+type OrderChange struct {
+	OrderUID string `json:"order_uid"`
+	Version  int64  `json:"version"`
+}
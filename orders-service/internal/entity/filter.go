@@ -0,0 +1,37 @@
+package entity
+
+import "time"
+
+// OrderFilter selects orders for listing. Zero values mean "any".
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	Entry           string
+	Locale          string
+	CreatedFrom     time.Time
+	CreatedTo       time.Time
+	Provider        string
+	Bank            string
+	Brand           string
+	NmID            int64
+
+	// Ascending sorts by date_created oldest first; newest first otherwise.
+	Ascending bool
+	Limit     int
+	// After continues a listing right after the given position.
+	After *OrderCursor
+}
+
+// OrderCursor is the position of an order in a date_created ordered listing.
+type OrderCursor struct {
+	DateCreated time.Time `json:"d"`
+	OrderUID    string    `json:"u"`
+}
+
+type OrderPage struct {
+	Orders []Order
+	// Next is the cursor of the last order of the page, or nil if there are
+	// no more orders.
+	Next *OrderCursor
+}
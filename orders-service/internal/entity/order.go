@@ -2,6 +2,21 @@ package entity
 
 import "time"
 
+// BrokerVersionBase is added to versions taken from the broker, which puts
+// them below every explicit version: an order versioned by its producer is
+// never overwritten by an unversioned message, while unversioned messages
+// are ordered among themselves.
+const BrokerVersionBase = -1 << 62
+
+// ProducerVersion returns v if it was set by the producer of an order and 0
+// if it was taken from the broker.
+func ProducerVersion(v int64) int64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
 type Order struct {
 	OrderUID          string    `json:"order_uid"`
 	TrackNumber       string    `json:"track_number"`
@@ -17,4 +32,12 @@ type Order struct {
 	SmID              int       `json:"sm_id"`
 	DateCreated       time.Time `json:"date_created"`
 	OofShard          string    `json:"oof_shard"`
+	// Version orders the states of the order. It is set by the producer;
+	// orders without one are versioned from the broker below every
+	// producer version, see BrokerVersionBase. Broker versions are not
+	// shown to clients.
+	Version int64 `json:"version,omitempty"`
+	// UpdatedAt is when the order was last written to the database; it is
+	// zero for orders that were not read from it.
+	UpdatedAt time.Time `json:"-"`
 }
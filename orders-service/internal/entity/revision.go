@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// EventSource identifies the Kafka message an accepted order state came from.
+type EventSource struct {
+	Topic      string    `json:"topic"`
+	Partition  int       `json:"partition"`
+	Offset     int64     `json:"offset"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// OrderRevision is one accepted state of an order. Order is only filled when
+// the snapshot itself was requested.
+type OrderRevision struct {
+	ID       int64       `json:"id"`
+	OrderUID string      `json:"order_uid"`
+	Version  int64       `json:"version,omitempty"`
+	Source   EventSource `json:"source"`
+	Order    *Order      `json:"order,omitempty"`
+}
+
+// FieldChange is a difference of one field between two order revisions.
+// Field is a dotted JSON path such as "delivery.phone" or "items[0].price".
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
@@ -0,0 +1,9 @@
+package entity
+
+// UserRole is the role of a user as issued by user-service in access tokens.
+type UserRole string
+
+const (
+	UserRoleAdmin UserRole = "admin"
+	UserRoleUser  UserRole = "user"
+)
@@ -0,0 +1,164 @@
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prefix marks encrypted values. The full format is
+// "enc:v1:<master key id>:<wrapped data key>:<nonce and ciphertext>", with
+// both binary parts in unpadded base64url.
+const prefix = "enc:v1:"
+
+const (
+	// dataKeyTTL is how long one data key encrypts new values before a new
+	// one is requested from the key provider.
+	dataKeyTTL = time.Hour
+	// maxCachedKeys bounds the unwrapped data keys kept for decryption.
+	maxCachedKeys = 1024
+)
+
+var ErrMalformed = errors.New("malformed encrypted value")
+
+// Encryptor encrypts values with envelope encryption: values are sealed with
+// a data key, which is stored next to them wrapped by a master key of the
+// key provider. Data keys are reused for a while so that the provider is
+// not called for every value.
+type Encryptor struct {
+	kp KeyProvider
+
+	mu      sync.Mutex
+	current *dataKey
+	cache   map[string]cipher.AEAD
+}
+
+type dataKey struct {
+	aead    cipher.AEAD
+	header  string
+	expires time.Time
+}
+
+func NewEncryptor(kp KeyProvider) *Encryptor {
+	return &Encryptor{kp: kp, cache: make(map[string]cipher.AEAD)}
+}
+
+// IsEncrypted reports whether v was produced by Encrypt.
+func IsEncrypted(v string) bool {
+	return strings.HasPrefix(v, prefix)
+}
+
+// Encrypt seals v, binding it to aad, which must be passed again to Decrypt.
+// Empty values are left as they are.
+func (e *Encryptor) Encrypt(ctx context.Context, v, aad string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+
+	dk, err := e.dataKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dk.aead, []byte(v), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return dk.header + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt. Values that are not encrypted,
+// e.g. written before encryption was enabled, are returned as they are.
+func (e *Encryptor) Decrypt(ctx context.Context, v, aad string) (string, error) {
+	if !IsEncrypted(v) {
+		return v, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(v, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	keyID, wrappedEnc, sealedEnc := parts[0], parts[1], parts[2]
+
+	sealed, err := base64.RawURLEncoding.DecodeString(sealedEnc)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	aead, err := e.unwrap(ctx, keyID, wrappedEnc)
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := open(aead, sealed, []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("decrypt: %w", err)
+	}
+	return string(plain), nil
+}
+
+func (e *Encryptor) dataKey(ctx context.Context) (*dataKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current != nil && time.Now().Before(e.current.expires) {
+		return e.current, nil
+	}
+
+	plain, wrapped, keyID, err := e.kp.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("generate data key: %w", err)
+	}
+	aead, err := newAEAD(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedEnc := base64.RawURLEncoding.EncodeToString(wrapped)
+	e.current = &dataKey{
+		aead:    aead,
+		header:  prefix + keyID + ":" + wrappedEnc + ":",
+		expires: time.Now().Add(dataKeyTTL),
+	}
+	e.cacheKey(keyID+":"+wrappedEnc, aead)
+	return e.current, nil
+}
+
+func (e *Encryptor) unwrap(ctx context.Context, keyID, wrappedEnc string) (cipher.AEAD, error) {
+	cacheID := keyID + ":" + wrappedEnc
+
+	e.mu.Lock()
+	aead, ok := e.cache[cacheID]
+	e.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(wrappedEnc)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	plain, err := e.kp.DecryptDataKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	if aead, err = newAEAD(plain); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.cacheKey(cacheID, aead)
+	e.mu.Unlock()
+	return aead, nil
+}
+
+// cacheKey must be called with mu held.
+func (e *Encryptor) cacheKey(id string, aead cipher.AEAD) {
+	if len(e.cache) >= maxCachedKeys {
+		clear(e.cache)
+	}
+	e.cache[id] = aead
+}
@@ -0,0 +1,189 @@
+package fieldcrypt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T, current string, keys map[string][]byte) string {
+	t.Helper()
+	f := keyFile{Current: current, Keys: make(map[string]string, len(keys))}
+	for id, key := range keys {
+		f.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestEncryptor(t *testing.T, current string, keys map[string][]byte) *Encryptor {
+	t.Helper()
+	kp, err := LoadKeyFile(writeKeyFile(t, current, keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEncryptor(kp)
+}
+
+func key(b byte) []byte {
+	return []byte(strings.Repeat(string(b), 32))
+}
+
+// tamper changes the i-th character of part n of an encrypted value, counting
+// the key id, the wrapped data key and the ciphertext as parts 0 to 2.
+func tamper(v string, n, i int) string {
+	parts := strings.Split(strings.TrimPrefix(v, prefix), ":")
+	b := []byte(parts[n])
+	if b[i] == 'A' {
+		b[i] = 'B'
+	} else {
+		b[i] = 'A'
+	}
+	parts[n] = string(b)
+	return prefix + strings.Join(parts, ":")
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ctx := context.Background()
+	keys := map[string][]byte{"k1": key('1'), "k2": key('2')}
+	enc := newTestEncryptor(t, "k1", keys)
+
+	sealed, err := enc.Encrypt(ctx, "+9720000000", "order-1/phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(sealed) || strings.Contains(sealed, "9720000000") {
+		t.Fatalf("Encrypt returned %q", sealed)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		aad     string
+		want    string
+		wantErr bool
+	}{
+		{name: "round trip", value: sealed, aad: "order-1/phone", want: "+9720000000"},
+		{name: "plaintext passes through", value: "+9720000000", aad: "order-1/phone", want: "+9720000000"},
+		{name: "empty passes through", value: "", aad: "order-1/phone", want: ""},
+		{name: "other field", value: sealed, aad: "order-1/email", wantErr: true},
+		{name: "other order", value: sealed, aad: "order-2/phone", wantErr: true},
+		{name: "tampered ciphertext", value: tamper(sealed, 2, 20), aad: "order-1/phone", wantErr: true},
+		{name: "tampered data key", value: tamper(sealed, 1, 20), aad: "order-1/phone", wantErr: true},
+		{name: "swapped master key id", value: strings.Replace(sealed, ":k1:", ":k2:", 1), aad: "order-1/phone", wantErr: true},
+		{name: "unknown master key id", value: strings.Replace(sealed, ":k1:", ":k9:", 1), aad: "order-1/phone", wantErr: true},
+		{name: "missing part", value: prefix + "k1:abc", aad: "order-1/phone", wantErr: true},
+		{name: "bad base64", value: prefix + "k1:abc:!!!", aad: "order-1/phone", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a fresh encryptor has no unwrapped data keys cached, so that
+			// tampering with the wrapped key is noticed
+			got, err := newTestEncryptor(t, "k1", keys).Decrypt(ctx, tt.value, tt.aad)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Decrypt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptReusesDataKey(t *testing.T) {
+	ctx := context.Background()
+	enc := newTestEncryptor(t, "k1", map[string][]byte{"k1": key('1')})
+
+	a, err := enc.Encrypt(ctx, "same", "aad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := enc.Encrypt(ctx, "same", "aad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := func(v string) string { return v[:strings.LastIndex(v, ":")] }
+	if header(a) != header(b) {
+		t.Fatalf("data key not reused: %q and %q", header(a), header(b))
+	}
+	if a == b {
+		t.Fatal("equal values encrypted to the same ciphertext")
+	}
+}
+
+func TestMasterKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	old, err := newTestEncryptor(t, "k1", map[string][]byte{"k1": key('1')}).Encrypt(ctx, "Test Testov", "order-1/name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newTestEncryptor(t, "k2", map[string][]byte{"k1": key('1'), "k2": key('2')})
+	fresh, err := rotated.Encrypt(ctx, "Test Testov", "order-1/name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fresh, prefix+"k2:") {
+		t.Fatalf("value not encrypted with the current key: %q", fresh)
+	}
+
+	tests := []struct {
+		name    string
+		keys    map[string][]byte
+		value   string
+		wantErr error
+	}{
+		{"old value with old key kept", map[string][]byte{"k1": key('1'), "k2": key('2')}, old, nil},
+		{"new value", map[string][]byte{"k1": key('1'), "k2": key('2')}, fresh, nil},
+		{"old value with old key dropped", map[string][]byte{"k2": key('2')}, old, ErrUnknownKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTestEncryptor(t, "k2", tt.keys).Decrypt(ctx, tt.value, "order-1/name")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decrypt error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != "Test Testov" {
+				t.Fatalf("Decrypt = %q", got)
+			}
+		})
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		keys    map[string][]byte
+		wantErr bool
+	}{
+		{name: "valid", current: "k1", keys: map[string][]byte{"k1": key('1')}},
+		{name: "short key", current: "k1", keys: map[string][]byte{"k1": key('1')[:16]}, wantErr: true},
+		{name: "missing current key", current: "k2", keys: map[string][]byte{"k1": key('1')}, wantErr: true},
+		{name: "colon in key id", current: "k:1", keys: map[string][]byte{"k:1": key('1')}, wantErr: true},
+		{name: "empty key id", current: "", keys: map[string][]byte{"": key('1')}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeyFile(writeKeyFile(t, tt.current, tt.keys))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeyFile error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrUnknownKey = errors.New("unknown master key")
+
+// KeyProvider wraps and unwraps data keys with master keys it never reveals,
+// the way a KMS does. Master keys are identified by an id that is stored
+// with everything they protect.
+type KeyProvider interface {
+	// GenerateDataKey returns a new 256-bit data key, the same key wrapped by
+	// the current master key and the id of that master key.
+	GenerateDataKey(ctx context.Context) (plaintext, wrapped []byte, keyID string, err error)
+	// DecryptDataKey unwraps a data key wrapped by master key keyID.
+	DecryptDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// FileKeyProvider is a KeyProvider with master keys read from a local file:
+//
+//	{"current": "2026-10", "keys": {"2026-01": "<base64>", "2026-10": "<base64>"}}
+//
+// Each key is 32 random bytes. Rotating means adding a key and making it
+// current; older keys must stay in the file as long as data wrapped by them
+// exists.
+type FileKeyProvider struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+type keyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+func LoadKeyFile(path string) (*FileKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f keyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+
+	p := &FileKeyProvider{current: f.Current, keys: make(map[string]cipher.AEAD, len(f.Keys))}
+	for id, enc := range f.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key file %s: invalid key id %q", path, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("key file %s: key %q: %w", path, id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key file %s: key %q must be 32 bytes", path, id)
+		}
+		if p.keys[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := p.keys[f.Current]; !ok {
+		return nil, fmt.Errorf("key file %s: %w: current key %q", path, ErrUnknownKey, f.Current)
+	}
+	return p, nil
+}
+
+func (p *FileKeyProvider) GenerateDataKey(_ context.Context) ([]byte, []byte, string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, "", err
+	}
+	wrapped, err := seal(p.keys[p.current], key, []byte(p.current))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return key, wrapped, p.current, nil
+}
+
+func (p *FileKeyProvider) DecryptDataKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	return open(aead, wrapped, []byte(keyID))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns the nonce followed by the ciphertext.
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], aad)
+}
@@ -0,0 +1,253 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	entity2 "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/fieldcrypt"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// encryptedField is a PII column stored encrypted when the repository has an
+// encryptor. Each value is bound to its order and field, so ciphertexts
+// cannot be moved between rows or columns. None of these columns can be
+// searched by.
+type encryptedField struct {
+	name   string
+	table  string
+	column string
+	value  func(o *entity2.Order) *string
+}
+
+var encryptedFields = []encryptedField{
+	{"delivery.name", "delivery", "name", func(o *entity2.Order) *string { return &o.Delivery.Name }},
+	{"delivery.phone", "delivery", "phone", func(o *entity2.Order) *string { return &o.Delivery.Phone }},
+	{"delivery.address", "delivery", "address", func(o *entity2.Order) *string { return &o.Delivery.Address }},
+	{"delivery.email", "delivery", "email", func(o *entity2.Order) *string { return &o.Delivery.Email }},
+	{"payment.transaction", "payment", "transaction", func(o *entity2.Order) *string { return &o.Payment.Transaction }},
+}
+
+func fieldAAD(orderUID, field string) string {
+	return orderUID + "/" + field
+}
+
+// encrypted returns a copy of o with the encrypted fields encrypted, or o
+// itself if the repository has no encryptor.
+func (r *Repository) encrypted(ctx context.Context, o *entity2.Order) (*entity2.Order, error) {
+	if r.enc == nil {
+		return o, nil
+	}
+
+	enc := *o
+	for _, f := range encryptedFields {
+		v := f.value(&enc)
+		sealed, err := r.enc.Encrypt(ctx, *v, fieldAAD(o.OrderUID, f.name))
+		if err != nil {
+			return nil, fmt.Errorf("%w: encrypt %s: %w", infrastructure.ErrInternalDatabase, f.name, err)
+		}
+		*v = sealed
+	}
+	return &enc, nil
+}
+
+// decrypt decrypts the encrypted fields of orders in place. Plaintext values,
+// e.g. of rows not migrated yet, are kept as they are.
+func (r *Repository) decrypt(ctx context.Context, orders []entity2.Order) error {
+	if r.enc == nil {
+		return nil
+	}
+
+	for i := range orders {
+		o := &orders[i]
+		for _, f := range encryptedFields {
+			v := f.value(o)
+			plain, err := r.enc.Decrypt(ctx, *v, fieldAAD(o.OrderUID, f.name))
+			if err != nil {
+				return fmt.Errorf("%w: decrypt %s of %s: %w", infrastructure.ErrInternalDatabase, f.name, o.OrderUID, err)
+			}
+			*v = plain
+		}
+	}
+	return nil
+}
+
+// EncryptExisting encrypts the PII columns and revision snapshots written
+// before encryption was enabled, batchSize rows per transaction. It can be
+// run while orders are being saved and resumed after a failure; fn is told
+// how many rows of which table every batch changed.
+func (r *Repository) EncryptExisting(ctx context.Context, batchSize int, fn func(table string, n int)) error {
+	if r.enc == nil {
+		return fmt.Errorf("%w: no encryptor configured", infrastructure.ErrInternalDatabase)
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	for _, table := range []string{"delivery", "payment"} {
+		if err := r.encryptTable(ctx, table, batchSize, fn); err != nil {
+			return err
+		}
+	}
+	return r.encryptRevisions(ctx, batchSize, fn)
+}
+
+// encryptTable encrypts the plaintext encrypted fields of table. A value is
+// only replaced if it is still the one that was read, so that a concurrent
+// save is never overwritten.
+func (r *Repository) encryptTable(ctx context.Context, table string, batchSize int, fn func(string, int)) error {
+	var fields []encryptedField
+	var cols, sets []string
+	for _, f := range encryptedFields {
+		if f.table != table {
+			continue
+		}
+		fields = append(fields, f)
+		cols = append(cols, "coalesce("+f.column+", '')")
+		sets = append(sets, fmt.Sprintf("%[1]s = CASE WHEN %[1]s = @old_%[1]s THEN @new_%[1]s ELSE %[1]s END", f.column))
+	}
+
+	sel := fmt.Sprintf(`
+		SELECT order_uid, %s
+		FROM %s
+		WHERE order_uid > @after
+		ORDER BY order_uid
+		LIMIT @lim
+	`, strings.Join(cols, ", "), table)
+	upd := fmt.Sprintf("UPDATE %s SET %s WHERE order_uid = @order_uid", table, strings.Join(sets, ", "))
+
+	var after string
+	for {
+		rows, err := r.pool.Query(ctx, sel, pgx.NamedArgs{"after": after, "lim": batchSize})
+		if err != nil {
+			return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		}
+
+		b := &pgx.Batch{}
+		read := 0
+		for rows.Next() {
+			var uid string
+			vals := make([]string, len(fields))
+			dest := []any{&uid}
+			for i := range vals {
+				dest = append(dest, &vals[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+			}
+			read++
+			after = uid
+
+			args := pgx.NamedArgs{"order_uid": uid}
+			changed := false
+			for i, f := range fields {
+				sealed := vals[i]
+				if vals[i] != "" && !fieldcrypt.IsEncrypted(vals[i]) {
+					if sealed, err = r.enc.Encrypt(ctx, vals[i], fieldAAD(uid, f.name)); err != nil {
+						rows.Close()
+						return fmt.Errorf("%w: encrypt %s: %w", infrastructure.ErrInternalDatabase, f.name, err)
+					}
+					changed = true
+				}
+				args["old_"+f.column] = vals[i]
+				args["new_"+f.column] = sealed
+			}
+			if changed {
+				b.Queue(upd, args)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		}
+
+		if b.Len() > 0 {
+			if err := r.pool.SendBatch(ctx, b).Close(); err != nil {
+				return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+			}
+			fn(table, b.Len())
+		}
+		if read < batchSize {
+			return nil
+		}
+	}
+}
+
+// encryptRevisions encrypts the encrypted fields in the stored snapshots.
+// Snapshots are never updated otherwise and hold either no or only encrypted
+// values.
+func (r *Repository) encryptRevisions(ctx context.Context, batchSize int, fn func(string, int)) error {
+	var after int64
+	for {
+		rows, err := r.pool.Query(ctx, `
+			SELECT id, snapshot
+			FROM order_revisions
+			WHERE id > @after
+			ORDER BY id
+			LIMIT @lim
+		`, pgx.NamedArgs{"after": after, "lim": batchSize})
+		if err != nil {
+			return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		}
+
+		b := &pgx.Batch{}
+		read := 0
+		for rows.Next() {
+			var snapshot []byte
+			if err := rows.Scan(&after, &snapshot); err != nil {
+				rows.Close()
+				return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+			}
+			read++
+
+			var o entity2.Order
+			if err := json.Unmarshal(snapshot, &o); err != nil {
+				rows.Close()
+				return fmt.Errorf("%w: decode snapshot %d: %w", infrastructure.ErrInternalDatabase, after, err)
+			}
+			if snapshotEncrypted(&o) {
+				continue
+			}
+			enc, err := r.encrypted(ctx, &o)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if snapshot, err = json.Marshal(enc); err != nil {
+				rows.Close()
+				return fmt.Errorf("marshal order snapshot: %w", err)
+			}
+			b.Queue(`UPDATE order_revisions SET snapshot = @snapshot WHERE id = @id`,
+				pgx.NamedArgs{"id": after, "snapshot": snapshot})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		}
+
+		if b.Len() > 0 {
+			if err := r.pool.SendBatch(ctx, b).Close(); err != nil {
+				return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+			}
+			fn("order_revisions", b.Len())
+		}
+		if read < batchSize {
+			return nil
+		}
+	}
+}
+
+// snapshotEncrypted reports whether o was encrypted before it was stored, or
+// has no value that would need to be.
+func snapshotEncrypted(o *entity2.Order) bool {
+	for _, f := range encryptedFields {
+		if v := *f.value(o); v != "" {
+			return fieldcrypt.IsEncrypted(v)
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	entity2 "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// OrdersChangedChannel is notified by the orders_changed trigger on every
+// insert or update of an order.
+const OrdersChangedChannel = "orders_changed"
+
+const (
+	listenMinBackoff = time.Second
+	listenMaxBackoff = 30 * time.Second
+)
+
+// OrderListener receives order change notifications sent by any instance
+// writing to the database.
+type OrderListener struct {
+	pool      *pgxpool.Pool
+	logger    *zap.Logger
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+func NewOrderListener(pool *pgxpool.Pool, logger *zap.Logger) *OrderListener {
+	return &OrderListener{pool: pool, logger: logger, ready: make(chan struct{})}
+}
+
+// Ready is closed once Listen is listening for the first time, i.e. once no
+// change made afterwards can be missed.
+func (l *OrderListener) Ready() <-chan struct{} {
+	return l.ready
+}
+
+// Listen calls onChange for every changed order until ctx is done. A lost
+// connection is re-established with backoff, after which onReconnect is
+// called, since notifications sent in between are not delivered.
+func (l *OrderListener) Listen(ctx context.Context, onChange func(entity2.OrderChange), onReconnect func()) error {
+	backoff := listenMinBackoff
+	connected := false
+
+	for {
+		err := l.listen(ctx, func() {
+			if connected {
+				l.logger.Info("order change listener reconnected")
+				onReconnect()
+			}
+			connected = true
+			backoff = listenMinBackoff
+			l.readyOnce.Do(func() { close(l.ready) })
+		}, onChange)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		l.logger.Warn("order change listener disconnected",
+			zap.Error(err),
+			zap.Duration("retry_in", backoff),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, listenMaxBackoff)
+	}
+}
+
+// listen holds a dedicated connection until it fails. The connection is
+// taken out of the pool so that it is never reused while still listening.
+func (l *OrderListener) listen(ctx context.Context, onListening func(), onChange func(entity2.OrderChange)) error {
+	pc, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	conn := pc.Hijack()
+	defer func() { _ = conn.Close(context.Background()) }()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{OrdersChangedChannel}.Sanitize()); err != nil {
+		return err
+	}
+	onListening()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var ch entity2.OrderChange
+		if err := json.Unmarshal([]byte(n.Payload), &ch); err != nil || ch.OrderUID == "" {
+			l.logger.Warn("bad order change notification",
+				zap.String("payload", n.Payload),
+				zap.Error(err),
+			)
+			continue
+		}
+		onChange(ch)
+	}
+}
@@ -2,38 +2,120 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	entity2 "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/fieldcrypt"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Repository struct {
 	pool *pgxpool.Pool
+	enc  *fieldcrypt.Encryptor
 }
 
-func NewOrderRepository(pool *pgxpool.Pool) *Repository {
-	return &Repository{pool: pool}
+// NewOrderRepository returns a repository that stores the PII columns listed
+// in encryptedFields encrypted with enc, or in plaintext if enc is nil.
+func NewOrderRepository(pool *pgxpool.Pool, enc *fieldcrypt.Encryptor) *Repository {
+	return &Repository{pool: pool, enc: enc}
 }
 
-func (r *Repository) Save(ctx context.Context, o *entity2.Order) error {
+// Save upserts o and records it as a revision read from src, unless the
+// stored order has the same or a newer version, in which case nothing is
+// written and infrastructure.ErrStaleVersion is returned.
+func (r *Repository) Save(ctx context.Context, o *entity2.Order, src entity2.EventSource) error {
+	errs, err := r.SaveBatch(ctx, []*entity2.Order{o}, []entity2.EventSource{src})
+	if err != nil {
+		return err
+	}
+	return errs[0]
+}
+
+// SaveBatch upserts all orders in a single transaction, srcs[i] being the
+// source of orders[i]. The returned slice holds
+// infrastructure.ErrStaleVersion at the index of every order that was
+// skipped because a same or newer version is already stored.
+func (r *Repository) SaveBatch(ctx context.Context, orders []*entity2.Order, srcs []entity2.EventSource) ([]error, error) {
+	errs := make([]error, len(orders))
+	if len(orders) == 0 {
+		return errs, nil
+	}
+	if len(srcs) != len(orders) {
+		return nil, fmt.Errorf("%w: %d orders with %d sources", infrastructure.ErrInternalDatabase, len(orders), len(srcs))
+	}
+
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		return nil, wrapSaveError(err)
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	_, err = tx.Exec(ctx, `
+	b := &pgx.Batch{}
+	for _, o := range orders {
+		queueOrder(b, o)
+	}
+
+	br := tx.SendBatch(ctx, b)
+	for i := range orders {
+		var uid string
+		err := br.QueryRow().Scan(&uid)
+		if errors.Is(err, pgx.ErrNoRows) {
+			errs[i] = infrastructure.ErrStaleVersion
+			continue
+		}
+		if err != nil {
+			_ = br.Close()
+			return nil, wrapSaveError(err)
+		}
+	}
+	if err := br.Close(); err != nil {
+		return nil, wrapSaveError(err)
+	}
+
+	b = &pgx.Batch{}
+	for i, o := range orders {
+		if errs[i] != nil {
+			continue
+		}
+		enc, err := r.encrypted(ctx, o)
+		if err != nil {
+			return nil, err
+		}
+		queueOrderDetails(b, enc)
+		if err := queueRevision(b, enc, srcs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	br = tx.SendBatch(ctx, b)
+	if err := br.Close(); err != nil {
+		return nil, wrapSaveError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, wrapSaveError(err)
+	}
+	return errs, nil
+}
+
+// queueOrder adds the upsert of the orders row of o to b. The statement
+// returns the order_uid only if the row was written, i.e. if no same or newer
+// version is stored.
+func queueOrder(b *pgx.Batch, o *entity2.Order) {
+	b.Queue(`
 		INSERT INTO orders (
 			order_uid, track_number, entry, locale, internal_signature,
-			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, updated_at
+			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, version, updated_at
 		) VALUES (
 			@order_uid, @track_number, @entry, @locale, @internal_signature,
-			@customer_id, @delivery_service, @shardkey, @sm_id, @date_created, @oof_shard, now()
+			@customer_id, @delivery_service, @shardkey, @sm_id, @date_created, @oof_shard, @version, now()
 		)
 		ON CONFLICT (order_uid) DO UPDATE SET
 			track_number=EXCLUDED.track_number,
@@ -46,7 +128,10 @@ func (r *Repository) Save(ctx context.Context, o *entity2.Order) error {
 			sm_id=EXCLUDED.sm_id,
 			date_created=EXCLUDED.date_created,
 			oof_shard=EXCLUDED.oof_shard,
+			version=EXCLUDED.version,
 			updated_at=now()
+		WHERE orders.version < EXCLUDED.version
+		RETURNING order_uid
 	`, pgx.NamedArgs{
 		"order_uid":          o.OrderUID,
 		"track_number":       o.TrackNumber,
@@ -59,12 +144,14 @@ func (r *Repository) Save(ctx context.Context, o *entity2.Order) error {
 		"sm_id":              o.SmID,
 		"date_created":       o.DateCreated,
 		"oof_shard":          o.OofShard,
+		"version":            o.Version,
 	})
-	if err != nil {
-		return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
-	}
+}
 
-	_, err = tx.Exec(ctx, `
+// queueOrderDetails adds the upserts of the delivery, payment and items rows
+// of o to b. Items that are no longer part of o are deleted.
+func queueOrderDetails(b *pgx.Batch, o *entity2.Order) {
+	b.Queue(`
 		INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
 		VALUES (@order_uid,@name,@phone,@zip,@city,@address,@region,@email)
 		ON CONFLICT (order_uid) DO UPDATE SET
@@ -85,11 +172,8 @@ func (r *Repository) Save(ctx context.Context, o *entity2.Order) error {
 		"region":    o.Delivery.Region,
 		"email":     o.Delivery.Email,
 	})
-	if err != nil {
-		return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
-	}
 
-	_, err = tx.Exec(ctx, `
+	b.Queue(`
 		INSERT INTO payment (
 			order_uid, transaction, request_id, currency, provider,
 			amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
@@ -121,16 +205,21 @@ func (r *Repository) Save(ctx context.Context, o *entity2.Order) error {
 		"goods_total":   o.Payment.GoodsTotal,
 		"custom_fee":    o.Payment.CustomFee,
 	})
-	if err != nil {
-		return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
-	}
 
-	b := &pgx.Batch{}
+	chrtIDs := make([]int64, 0, len(o.Items))
 	for _, it := range o.Items {
-		if it.ChrtID == 0 {
-			continue
-		}
+		chrtIDs = append(chrtIDs, it.ChrtID)
+	}
+
+	b.Queue(`
+		DELETE FROM items
+		WHERE order_uid = @order_uid AND chrt_id <> ALL(@chrt_ids)
+	`, pgx.NamedArgs{
+		"order_uid": o.OrderUID,
+		"chrt_ids":  chrtIDs,
+	})
 
+	for _, it := range o.Items {
 		b.Queue(`
 			INSERT INTO items (
 				order_uid, chrt_id, track_number, price, rid, name, sale, size,
@@ -165,115 +254,337 @@ func (r *Repository) Save(ctx context.Context, o *entity2.Order) error {
 			"status":       it.Status,
 		})
 	}
+}
 
-	br := tx.SendBatch(ctx, b)
-	if err := br.Close(); err != nil {
-		return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+// queueRevision adds the insert of a snapshot of o into order_revisions to b.
+func queueRevision(b *pgx.Batch, o *entity2.Order, src entity2.EventSource) error {
+	snapshot, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("marshal order snapshot: %w", err)
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+	receivedAt := src.ReceivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now().UTC()
 	}
+
+	b.Queue(`
+		INSERT INTO order_revisions (
+			order_uid, version, snapshot, kafka_topic, kafka_partition, kafka_offset, received_at
+		) VALUES (
+			@order_uid, @version, @snapshot, @kafka_topic, @kafka_partition, @kafka_offset, @received_at
+		)
+	`, pgx.NamedArgs{
+		"order_uid":       o.OrderUID,
+		"version":         o.Version,
+		"snapshot":        snapshot,
+		"kafka_topic":     src.Topic,
+		"kafka_partition": src.Partition,
+		"kafka_offset":    src.Offset,
+		"received_at":     receivedAt,
+	})
 	return nil
 }
 
-func (r *Repository) GetByID(ctx context.Context, id string) (*entity2.Order, error) {
-	const q = `
-		SELECT
-			o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
-			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
-			d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
-			p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
-			p.bank, p.delivery_cost, p.goods_total, p.custom_fee
-		FROM orders o
-		LEFT JOIN delivery d ON d.order_uid = o.order_uid
-		LEFT JOIN payment  p ON p.order_uid = o.order_uid
-		WHERE o.order_uid = @id
-	`
+// orderSelect selects everything but the items of an order; scanOrder reads
+// a row of it.
+const orderSelect = `
+	SELECT
+		o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+		o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.version, o.updated_at,
+		d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+		p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
+		p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+	FROM orders o
+	LEFT JOIN delivery d ON d.order_uid = o.order_uid
+	LEFT JOIN payment  p ON p.order_uid = o.order_uid
+`
 
+func scanOrder(row pgx.Row) (entity2.Order, error) {
 	var o entity2.Order
 	var created time.Time
 
-	err := r.pool.QueryRow(ctx, q, pgx.NamedArgs{"id": id}).Scan(
+	err := row.Scan(
 		&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
-		&o.CustomerID, &o.DeliveryService, &o.ShardKey, &o.SmID, &created, &o.OofShard,
+		&o.CustomerID, &o.DeliveryService, &o.ShardKey, &o.SmID, &created, &o.OofShard, &o.Version, &o.UpdatedAt,
 		&o.Delivery.Name, &o.Delivery.Phone, &o.Delivery.Zip, &o.Delivery.City, &o.Delivery.Address, &o.Delivery.Region, &o.Delivery.Email,
 		&o.Payment.Transaction, &o.Payment.RequestID, &o.Payment.Currency, &o.Payment.Provider, &o.Payment.Amount, &o.Payment.PaymentDT,
 		&o.Payment.Bank, &o.Payment.DeliveryCost, &o.Payment.GoodsTotal, &o.Payment.CustomFee,
 	)
+	o.DateCreated = created
+	return o, err
+}
+
+func (r *Repository) GetByID(ctx context.Context, id string) (*entity2.Order, error) {
+	o, err := scanOrder(r.pool.QueryRow(ctx, orderSelect+" WHERE o.order_uid = @id", pgx.NamedArgs{"id": id}))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, infrastructure.ErrOrderNotFound
 		}
 		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
 	}
-	o.DateCreated = created
 
+	orders := []entity2.Order{o}
+	if err := r.decrypt(ctx, orders); err != nil {
+		return nil, err
+	}
+	if err := r.attachItems(ctx, orders); err != nil {
+		return nil, err
+	}
+	return &orders[0], nil
+}
+
+// UpdatedAt returns the last write time of each of the given orders that
+// exists.
+func (r *Repository) UpdatedAt(ctx context.Context, ids []string) (map[string]time.Time, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT order_uid, updated_at
+		FROM orders
+		WHERE order_uid = ANY(@ids)
+	`, pgx.NamedArgs{"ids": ids})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+	}
+	defer rows.Close()
+
+	res := make(map[string]time.Time, len(ids))
+	for rows.Next() {
+		var id string
+		var updated time.Time
+		if err := rows.Scan(&id, &updated); err != nil {
+			return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		}
+		res[id] = updated
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+	}
+	return res, nil
+}
+
+// loadItems returns the items of all given orders, keyed by order_uid.
+func (r *Repository) loadItems(ctx context.Context, ids []string) (map[string][]entity2.Item, error) {
 	rows, err := r.pool.Query(ctx, `
-		SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+		SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
 		FROM items
-		WHERE order_uid = @id
-		ORDER BY chrt_id
-	`, pgx.NamedArgs{"id": id})
+		WHERE order_uid = ANY(@ids)
+		ORDER BY order_uid, chrt_id
+	`, pgx.NamedArgs{"ids": ids})
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
 	}
 	defer rows.Close()
 
-	items := make([]entity2.Item, 0, 8)
+	items := make(map[string][]entity2.Item, len(ids))
 	for rows.Next() {
+		var uid string
 		var it entity2.Item
 		if err := rows.Scan(
-			&it.ChrtID, &it.TrackNumber, &it.Price, &it.Rid, &it.Name,
+			&uid, &it.ChrtID, &it.TrackNumber, &it.Price, &it.Rid, &it.Name,
 			&it.Sale, &it.Size, &it.TotalPrice, &it.NmID, &it.Brand, &it.Status,
 		); err != nil {
 			return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
 		}
-		items = append(items, it)
+		items[uid] = append(items[uid], it)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
 	}
-	o.Items = items
-
-	return &o, nil
+	return items, nil
 }
 
-func (r *Repository) LoadRecent(ctx context.Context, limit int) ([]entity2.Order, error) {
+// LoadRecent passes up to limit most recently updated orders to fn, newest
+// first, in chunks of chunkSize. Every chunk costs three queries regardless
+// of its size; fn errors stop the load and are returned as is.
+func (r *Repository) LoadRecent(ctx context.Context, limit, chunkSize int, fn func([]entity2.Order) error) error {
 	if limit <= 0 {
 		limit = 1000
 	}
+	if chunkSize <= 0 {
+		chunkSize = 1000
+	}
 
-	rows, err := r.pool.Query(ctx, `
-		SELECT order_uid
-		FROM orders
-		ORDER BY updated_at DESC
-		LIMIT @lim
-	`, pgx.NamedArgs{"lim": limit})
+	var (
+		afterUpdated time.Time
+		afterUID     string
+		loaded       int
+	)
+	for loaded < limit {
+		n := min(chunkSize, limit-loaded)
+
+		q := `
+			SELECT order_uid, updated_at
+			FROM orders
+			ORDER BY updated_at DESC, order_uid DESC
+			LIMIT @lim
+		`
+		args := pgx.NamedArgs{"lim": n}
+		if afterUID != "" {
+			q = `
+				SELECT order_uid, updated_at
+				FROM orders
+				WHERE (updated_at, order_uid) < (@after_updated, @after_uid)
+				ORDER BY updated_at DESC, order_uid DESC
+				LIMIT @lim
+			`
+			args["after_updated"] = afterUpdated
+			args["after_uid"] = afterUID
+		}
+
+		rows, err := r.pool.Query(ctx, q, args)
+		if err != nil {
+			return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		}
+		ids := make([]string, 0, n)
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id, &afterUpdated); err != nil {
+				rows.Close()
+				return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		afterUID = ids[len(ids)-1]
+
+		orders, err := r.GetByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+		if err := fn(orders); err != nil {
+			return err
+		}
+
+		loaded += len(ids)
+		if len(ids) < n {
+			return nil
+		}
+	}
+	return nil
+}
+
+// GetByIDs returns the orders with the given ids in the order of ids, using
+// two queries. Unknown ids are left out.
+func (r *Repository) GetByIDs(ctx context.Context, ids []string) ([]entity2.Order, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := r.pool.Query(ctx, orderSelect+" WHERE o.order_uid = ANY(@ids)", pgx.NamedArgs{"ids": ids})
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
 	}
 	defer rows.Close()
 
-	ids := make([]string, 0, limit)
+	byID := make(map[string]entity2.Order, len(ids))
 	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
+		o, err := scanOrder(rows)
+		if err != nil {
 			return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
 		}
-		ids = append(ids, id)
+		byID[o.OrderUID] = o
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
 	}
 
-	out := make([]entity2.Order, 0, len(ids))
+	orders := make([]entity2.Order, 0, len(byID))
 	for _, id := range ids {
-		o, err := r.GetByID(ctx, id)
-		if err != nil {
-			return nil, err
+		if o, ok := byID[id]; ok {
+			orders = append(orders, o)
+			delete(byID, id)
+		}
+	}
+
+	if err := r.decrypt(ctx, orders); err != nil {
+		return nil, err
+	}
+	if err := r.attachItems(ctx, orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// wrapSaveError separates errors caused by the order itself (bad values,
+// constraint violations) from failures of the database, which are worth
+// retrying.
+func wrapSaveError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// class 22 is data exception, class 23 is integrity constraint violation
+		if strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23") {
+			return fmt.Errorf("%w: %w", infrastructure.ErrInvalidOrderData, err)
 		}
-		out = append(out, *o)
 	}
-	return out, nil
+	return fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+}
+
+// ListRevisions returns the revisions of the order, oldest first, without
+// their snapshots.
+func (r *Repository) ListRevisions(ctx context.Context, id string) ([]entity2.OrderRevision, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, order_uid, version,
+			coalesce(kafka_topic, ''), coalesce(kafka_partition, 0), coalesce(kafka_offset, 0), received_at
+		FROM order_revisions
+		WHERE order_uid = @id
+		ORDER BY id
+	`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+	}
+	defer rows.Close()
+
+	revs := make([]entity2.OrderRevision, 0, 8)
+	for rows.Next() {
+		var rev entity2.OrderRevision
+		if err := rows.Scan(
+			&rev.ID, &rev.OrderUID, &rev.Version,
+			&rev.Source.Topic, &rev.Source.Partition, &rev.Source.Offset, &rev.Source.ReceivedAt,
+		); err != nil {
+			return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		}
+		revs = append(revs, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+	}
+	return revs, nil
+}
+
+// GetRevision returns one revision of the order including its snapshot.
+func (r *Repository) GetRevision(ctx context.Context, id string, revID int64) (*entity2.OrderRevision, error) {
+	var rev entity2.OrderRevision
+	var snapshot []byte
+
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, order_uid, version, snapshot,
+			coalesce(kafka_topic, ''), coalesce(kafka_partition, 0), coalesce(kafka_offset, 0), received_at
+		FROM order_revisions
+		WHERE order_uid = @id AND id = @rev_id
+	`, pgx.NamedArgs{"id": id, "rev_id": revID}).Scan(
+		&rev.ID, &rev.OrderUID, &rev.Version, &snapshot,
+		&rev.Source.Topic, &rev.Source.Partition, &rev.Source.Offset, &rev.Source.ReceivedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, infrastructure.ErrRevisionNotFound
+		}
+		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+	}
+
+	orders := make([]entity2.Order, 1)
+	if err := json.Unmarshal(snapshot, &orders[0]); err != nil {
+		return nil, fmt.Errorf("%w: decode snapshot: %w", infrastructure.ErrInternalDatabase, err)
+	}
+	if err := r.decrypt(ctx, orders); err != nil {
+		return nil, err
+	}
+	rev.Order = &orders[0]
+	return &rev, nil
 }
@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	entity2 "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Search returns one page of the orders matching f, ordered by date_created
+// and order_uid. Paging is keyset based, so pages stay stable while new
+// orders arrive.
+func (r *Repository) Search(ctx context.Context, f entity2.OrderFilter) (*entity2.OrderPage, error) {
+	var where []string
+	args := pgx.NamedArgs{}
+
+	eq := func(column, name, value string) {
+		if value != "" {
+			where = append(where, column+" = @"+name)
+			args[name] = value
+		}
+	}
+	eq("o.customer_id", "customer_id", f.CustomerID)
+	eq("o.track_number", "track_number", f.TrackNumber)
+	eq("o.delivery_service", "delivery_service", f.DeliveryService)
+	eq("o.entry", "entry", f.Entry)
+	eq("o.locale", "locale", f.Locale)
+	eq("p.provider", "provider", f.Provider)
+	eq("p.bank", "bank", f.Bank)
+
+	if !f.CreatedFrom.IsZero() {
+		where = append(where, "o.date_created >= @created_from")
+		args["created_from"] = f.CreatedFrom
+	}
+	if !f.CreatedTo.IsZero() {
+		where = append(where, "o.date_created < @created_to")
+		args["created_to"] = f.CreatedTo
+	}
+	if f.Brand != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.brand = @brand)")
+		args["brand"] = f.Brand
+	}
+	if f.NmID != 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.nm_id = @nm_id)")
+		args["nm_id"] = f.NmID
+	}
+
+	dir, cmp := "DESC", "<"
+	if f.Ascending {
+		dir, cmp = "ASC", ">"
+	}
+	if f.After != nil {
+		where = append(where, fmt.Sprintf("(o.date_created, o.order_uid) %s (@after_created, @after_uid)", cmp))
+		args["after_created"] = f.After.DateCreated
+		args["after_uid"] = f.After.OrderUID
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	// one extra row tells whether there is a next page
+	args["lim"] = limit + 1
+
+	q := orderSelect
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += fmt.Sprintf(" ORDER BY o.date_created %s, o.order_uid %s LIMIT @lim", dir, dir)
+
+	rows, err := r.pool.Query(ctx, q, args)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+	}
+	defer rows.Close()
+
+	orders := make([]entity2.Order, 0, limit+1)
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInternalDatabase, err)
+	}
+
+	page := &entity2.OrderPage{}
+	if len(orders) > limit {
+		orders = orders[:limit]
+		last := orders[limit-1]
+		page.Next = &entity2.OrderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID}
+	}
+
+	if err := r.decrypt(ctx, orders); err != nil {
+		return nil, err
+	}
+	if err := r.attachItems(ctx, orders); err != nil {
+		return nil, err
+	}
+	page.Orders = orders
+	return page, nil
+}
+
+// attachItems loads the items of orders with a single query.
+func (r *Repository) attachItems(ctx context.Context, orders []entity2.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].OrderUID
+	}
+
+	items, err := r.loadItems(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range orders {
+		orders[i].Items = items[orders[i].OrderUID]
+		if orders[i].Items == nil {
+			orders[i].Items = make([]entity2.Item, 0)
+		}
+	}
+	return nil
+}
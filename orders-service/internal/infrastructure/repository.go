@@ -4,15 +4,26 @@ import (
 	"context"
 	"errors"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"time"
 )
 
 type Repository interface {
-	Save(ctx context.Context, o *entity.Order) error
+	Save(ctx context.Context, o *entity.Order, src entity.EventSource) error
+	SaveBatch(ctx context.Context, orders []*entity.Order, srcs []entity.EventSource) ([]error, error)
 	GetByID(ctx context.Context, id string) (*entity.Order, error)
-	LoadRecent(ctx context.Context, limit int) ([]entity.Order, error)
+	GetByIDs(ctx context.Context, ids []string) ([]entity.Order, error)
+	LoadRecent(ctx context.Context, limit, chunkSize int, fn func([]entity.Order) error) error
+	UpdatedAt(ctx context.Context, ids []string) (map[string]time.Time, error)
+	Search(ctx context.Context, f entity.OrderFilter) (*entity.OrderPage, error)
+
+	ListRevisions(ctx context.Context, id string) ([]entity.OrderRevision, error)
+	GetRevision(ctx context.Context, id string, revID int64) (*entity.OrderRevision, error)
 }
 
 var (
 	ErrInternalDatabase = errors.New("internal database error")
 	ErrOrderNotFound    = errors.New("order not found")
+	ErrInvalidOrderData = errors.New("order data rejected by database")
+	ErrStaleVersion     = errors.New("stored order has the same or a newer version")
+	ErrRevisionNotFound = errors.New("order revision not found")
 )
@@ -3,22 +3,57 @@ package consumer
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/delivery"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/metrics"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/service"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
+const workerQueueSize = 64
+
+// Retries of a message back off exponentially between these delays.
+const (
+	minRetryBackoff = 200 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// reader and writer are the parts of kafka.Reader and kafka.Writer the
+// consumer uses.
+type reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 type Consumer struct {
-	r   *kafka.Reader
-	svc delivery.OrderService
-	log *zap.Logger
+	r            reader
+	dlq          writer
+	parking      writer
+	minBackoff   time.Duration
+	maxAttempts  int
+	workers      int
+	batchSize    int
+	batchTimeout time.Duration
+	offsets      *offsetTracker
+	svc          delivery.OrderService
+	log          *zap.Logger
+	met          *metrics.Metrics
 }
 
-func New(cfg config.KafkaConsumerConfig, svc delivery.OrderService, logger *zap.Logger) *Consumer {
+func New(cfg config.KafkaConsumerConfig, svc delivery.OrderService, logger *zap.Logger, met *metrics.Metrics) *Consumer {
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:        cfg.Brokers,
 		Topic:          cfg.Topic,
@@ -28,13 +63,75 @@ func New(cfg config.KafkaConsumerConfig, svc delivery.OrderService, logger *zap.
 		CommitInterval: 0,
 	})
 
-	return &Consumer{r: r, svc: svc, log: logger}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	if met != nil {
+		met.KafkaWorkers.Set(float64(workers))
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	batchTimeout := cfg.BatchTimeout
+	if batchTimeout <= 0 {
+		batchTimeout = 100 * time.Millisecond
+	}
+
+	return &Consumer{
+		r:            r,
+		dlq:          newWriter(cfg.Brokers, cfg.DLQTopic),
+		parking:      newWriter(cfg.Brokers, cfg.ParkingTopic),
+		minBackoff:   minRetryBackoff,
+		maxAttempts:  maxAttempts,
+		workers:      workers,
+		batchSize:    batchSize,
+		batchTimeout: batchTimeout,
+		offsets:      newOffsetTracker(),
+		svc:          svc,
+		log:          logger,
+		met:          met,
+	}
 }
 
-func (c *Consumer) Close() error { return c.r.Close() }
+func (c *Consumer) Close() error {
+	return errors.Join(c.r.Close(), c.dlq.Close(), c.parking.Close())
+}
 
+// Run fetches messages and fans them out to the workers. All messages of a
+// partition go to the same worker, so they are processed in partition order;
+// producers are expected to key messages by order_uid, so that the updates of
+// one order share a partition. Offsets are committed per partition only up to
+// the highest contiguous processed offset.
 func (c *Consumer) Run(ctx context.Context) error {
-	backoff := 200 * time.Millisecond
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	queues := make([]chan kafka.Message, c.workers)
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, workerQueueSize)
+
+		wg.Add(1)
+		go func(q <-chan kafka.Message) {
+			defer wg.Done()
+			c.work(ctx, q)
+		}(queues[i])
+	}
+	defer func() {
+		cancel()
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+	}()
 
 	for {
 		m, err := c.r.FetchMessage(ctx)
@@ -42,41 +139,238 @@ func (c *Consumer) Run(ctx context.Context) error {
 			return err
 		}
 
-		err = c.svc.SaveOrderFromEvent(ctx, m.Value)
+		c.offsets.track(m)
+		if c.met != nil {
+			c.met.KafkaInFlight.Inc()
+		}
 
-		if errors.Is(err, service.ErrBadMessage) {
-			c.log.Warn("bad message, skipped",
-				zap.ByteString("value", m.Value),
-				zap.Error(err),
-			)
+		select {
+		case queues[c.worker(m)] <- m:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// work processes the messages of one queue, flushing them in batches of up
+// to batchSize messages or whatever arrived within batchTimeout. handle only
+// fails once ctx is done, after which the rest of the queue is drained
+// without committing.
+func (c *Consumer) work(ctx context.Context, q <-chan kafka.Message) {
+	batch := make([]kafka.Message, 0, c.batchSize)
+	var flushAfter <-chan time.Time
+
+	flush := func() {
+		c.flush(ctx, batch)
+		batch = batch[:0]
+		flushAfter = nil
+	}
+
+	for {
+		select {
+		case m, ok := <-q:
+			if !ok {
+				return
+			}
+			if ctx.Err() != nil {
+				continue
+			}
 
-			if e := c.r.CommitMessages(ctx, m); e != nil {
-				c.log.Error("commit error", zap.Error(e))
+			batch = append(batch, m)
+			if len(batch) >= c.batchSize {
+				flush()
+			} else if len(batch) == 1 {
+				flushAfter = time.After(c.batchTimeout)
 			}
-			continue
+
+		case <-flushAfter:
+			flush()
 		}
+	}
+}
 
-		if err != nil {
-			c.log.Error("failed to handle message, retry",
-				zap.Error(err),
-			)
+func (c *Consumer) flush(ctx context.Context, batch []kafka.Message) {
+	if len(batch) == 0 {
+		return
+	}
+	if c.met != nil {
+		c.met.KafkaBatch.Observe(float64(len(batch)))
+	}
+
+	var err error
+	if len(batch) == 1 {
+		err = c.handle(ctx, batch[0])
+	} else {
+		err = c.handleBatch(ctx, batch)
+	}
+	if err != nil {
+		return
+	}
 
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(backoff):
+	if c.met != nil {
+		c.met.KafkaInFlight.Sub(float64(len(batch)))
+	}
+	for _, m := range batch {
+		c.offsets.complete(m)
+	}
+	c.offsets.commit(func(msgs ...kafka.Message) {
+		if err := c.r.CommitMessages(ctx, msgs...); err != nil {
+			c.log.Error("commit error", zap.Int("partitions", len(msgs)), zap.Error(err))
+		}
+	})
+}
+
+// handleBatch saves batch in one transaction. Undecodable messages and
+// batches the database refuses are handled message by message, so that
+// dead-lettering and parking apply to the offending message only.
+func (c *Consumer) handleBatch(ctx context.Context, batch []kafka.Message) error {
+	evs := make([]entity.OrderEvent, len(batch))
+	for i, m := range batch {
+		evs[i] = orderEvent(m)
+	}
+
+	errs, err := c.svc.SaveOrdersFromEvents(ctx, evs)
+	if err != nil {
+		c.log.Warn("failed to save batch, falling back to single messages",
+			zap.Int("size", len(batch)),
+			zap.Error(err),
+		)
+		for _, m := range batch {
+			if err := c.handle(ctx, m); err != nil {
+				return err
 			}
+		}
+		return nil
+	}
 
-			if backoff < 5*time.Second {
-				backoff *= 2
+	for i, e := range errs {
+		switch {
+		case e == nil:
+		case errors.Is(e, service.ErrStaleEvent):
+			c.skipStale(batch[i])
+		default:
+			if err := c.deadLetter(ctx, batch[i], e); err != nil {
+				return err
 			}
-			continue
 		}
+	}
+	return nil
+}
+
+func (c *Consumer) skipStale(m kafka.Message) {
+	if c.met != nil {
+		c.met.KafkaStale.Inc()
+	}
+	c.log.Info("stale message skipped",
+		zap.Int("partition", m.Partition),
+		zap.Int64("offset", m.Offset),
+	)
+}
 
-		if err := c.r.CommitMessages(ctx, m); err != nil {
-			c.log.Error("commit error", zap.Error(err))
+func orderEvent(m kafka.Message) entity.OrderEvent {
+	return entity.OrderEvent{
+		Payload:   m.Value,
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Timestamp: m.Time,
+	}
+}
+
+// deadLetter publishes m to the dead-letter topic, retrying with backoff until
+// it succeeds. It only fails when ctx is done.
+func (c *Consumer) deadLetter(ctx context.Context, m kafka.Message, cause error) error {
+	backoff := c.minBackoff
+
+	for {
+		err := c.publishDeadLetter(ctx, m, cause)
+		if err == nil {
+			c.log.Warn("bad message, sent to dlq",
+				zap.Int("partition", m.Partition),
+				zap.Int64("offset", m.Offset),
+				zap.Error(cause),
+			)
+			return nil
 		}
 
-		backoff = 200 * time.Millisecond
+		c.log.Error("failed to publish bad message to dlq, retry",
+			zap.Int("partition", m.Partition),
+			zap.Int64("offset", m.Offset),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(2*backoff, maxRetryBackoff)
 	}
 }
+
+func (c *Consumer) worker(m kafka.Message) int {
+	return m.Partition % c.workers
+}
+
+// handle processes m until it is stored, sent to the dead-letter topic or
+// parked, retrying with backoff in between. Database outages are retried
+// indefinitely; any other failure is retried up to maxAttempts times before
+// the message is parked. It only fails when ctx is done.
+func (c *Consumer) handle(ctx context.Context, m kafka.Message) error {
+	backoff := c.minBackoff
+	attempts := 0
+
+	for {
+		err := c.svc.SaveOrderFromEvent(ctx, orderEvent(m))
+		if err == nil {
+			return nil
+		}
+
+		switch {
+		case errors.Is(err, service.ErrStaleEvent):
+			c.skipStale(m)
+			return nil
+
+		case errors.Is(err, service.ErrBadMessage):
+			return c.deadLetter(ctx, m, err)
+
+		case !isTransient(err):
+			attempts++
+			if attempts >= c.maxAttempts {
+				e := c.park(ctx, m, err, attempts)
+				if e == nil {
+					c.log.Warn("message parked after max attempts",
+						zap.Int("partition", m.Partition),
+						zap.Int64("offset", m.Offset),
+						zap.Int("attempts", attempts),
+						zap.Error(err),
+					)
+					return nil
+				}
+				err = fmt.Errorf("park message: %w", e)
+			}
+		}
+
+		c.log.Error("failed to handle message, retry",
+			zap.Int("partition", m.Partition),
+			zap.Int64("offset", m.Offset),
+			zap.Int("attempts", attempts),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+}
+
+// isTransient reports whether err is a database failure that is expected to
+// go away on its own, such as a lost connection.
+func isTransient(err error) bool {
+	return errors.Is(err, infrastructure.ErrInternalDatabase)
+}
@@ -0,0 +1,338 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/delivery"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/service"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// fakeService answers the saves of single messages with results in turn,
+// repeating the last one, and records the offsets it was asked to save.
+// Batches get batchResults, or batchErr if it is set.
+type fakeService struct {
+	delivery.OrderService
+	mu      sync.Mutex
+	results []error
+	saves   []int64
+
+	batchResults []error
+	batchErr     error
+	batches      int
+}
+
+func (s *fakeService) SaveOrdersFromEvents(_ context.Context, evs []entity.OrderEvent) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	if s.batchErr != nil {
+		return nil, s.batchErr
+	}
+	return s.batchResults[:len(evs)], nil
+}
+
+func (s *fakeService) SaveOrderFromEvent(_ context.Context, ev entity.OrderEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saves = append(s.saves, ev.Offset)
+	if len(s.results) == 0 {
+		return nil
+	}
+	err := s.results[0]
+	if len(s.results) > 1 {
+		s.results = s.results[1:]
+	}
+	return err
+}
+
+// fakeWriter records the messages written to it. The first fails writes
+// fail.
+type fakeWriter struct {
+	mu    sync.Mutex
+	fails int
+	msgs  []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fails > 0 {
+		w.fails--
+		return errors.New("broker unavailable")
+	}
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+// fakeReader records commits.
+type fakeReader struct {
+	reader
+	mu      sync.Mutex
+	commits []kafka.Message
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commits = append(r.commits, msgs...)
+	return nil
+}
+
+func newTestConsumer(svc delivery.OrderService) (*Consumer, *fakeReader, *fakeWriter, *fakeWriter) {
+	r, dlq, parking := &fakeReader{}, &fakeWriter{}, &fakeWriter{}
+	return &Consumer{
+		r:           r,
+		dlq:         dlq,
+		parking:     parking,
+		minBackoff:  time.Millisecond,
+		maxAttempts: 3,
+		workers:     1,
+		batchSize:   1,
+		offsets:     newOffsetTracker(),
+		svc:         svc,
+		log:         zap.NewNop(),
+	}, r, dlq, parking
+}
+
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func repeat(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+func TestHandleSortsErrors(t *testing.T) {
+	errOther := errors.New("constraint violated")
+	dbDown := fmt.Errorf("%w: connection refused", infrastructure.ErrInternalDatabase)
+
+	tests := []struct {
+		name string
+		// results are returned by the service for successive attempts,
+		// the last one for all further attempts.
+		results    []error
+		wantSaves  int
+		wantDLQ    bool
+		wantParked bool
+	}{
+		{name: "saved", results: []error{nil}, wantSaves: 1},
+		{name: "stale event skipped", results: []error{service.ErrStaleEvent}, wantSaves: 1},
+		{
+			name:      "bad message dead-lettered",
+			results:   []error{fmt.Errorf("%w: empty order_uid", service.ErrBadMessage)},
+			wantSaves: 1,
+			wantDLQ:   true,
+		},
+		{
+			name:      "database outage retried past max attempts",
+			results:   append(repeat(dbDown, 6), nil),
+			wantSaves: 7,
+		},
+		{
+			name:      "other error retried below max attempts",
+			results:   []error{errOther, errOther, nil},
+			wantSaves: 3,
+		},
+		{
+			name:       "other error parked at max attempts",
+			results:    []error{errOther},
+			wantSaves:  3,
+			wantParked: true,
+		},
+		{
+			name:       "outages do not count as attempts",
+			results:    []error{errOther, dbDown, dbDown, errOther, dbDown, errOther},
+			wantSaves:  6,
+			wantParked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeService{results: tt.results}
+			c, _, dlq, parking := newTestConsumer(svc)
+
+			if err := c.handle(context.Background(), kafka.Message{Topic: "orders", Offset: 7}); err != nil {
+				t.Fatalf("handle: %v", err)
+			}
+
+			if len(svc.saves) != tt.wantSaves {
+				t.Fatalf("saves = %d, want %d", len(svc.saves), tt.wantSaves)
+			}
+			if got := len(dlq.msgs) == 1; got != tt.wantDLQ || len(dlq.msgs) > 1 {
+				t.Fatalf("dead-lettered %d messages, want %v", len(dlq.msgs), tt.wantDLQ)
+			}
+			if got := len(parking.msgs) == 1; got != tt.wantParked || len(parking.msgs) > 1 {
+				t.Fatalf("parked %d messages, want %v", len(parking.msgs), tt.wantParked)
+			}
+			if tt.wantDLQ && header(dlq.msgs[0], HeaderOriginalOffset) != "7" {
+				t.Fatalf("dead letter headers %v", dlq.msgs[0].Headers)
+			}
+		})
+	}
+}
+
+func TestHandleStopsRetryingWhenCanceled(t *testing.T) {
+	svc := &fakeService{results: []error{fmt.Errorf("%w: connection refused", infrastructure.ErrInternalDatabase)}}
+	c, _, _, _ := newTestConsumer(svc)
+	c.minBackoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.handle(ctx, kafka.Message{}) }()
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("handle error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestParkedMessagesAreCommitted(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		parkingFails int
+		wantSaves    int
+	}{
+		{"parked at first failure", 1, 0, 1},
+		{"parked at max attempts", 4, 0, 4},
+		{"parking retried", 2, 2, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeService{results: []error{errors.New("constraint violated")}}
+			c, r, _, parking := newTestConsumer(svc)
+			c.maxAttempts = tt.maxAttempts
+			parking.fails = tt.parkingFails
+
+			m := kafka.Message{Topic: "orders", Partition: 2, Offset: 10}
+			c.offsets.track(m)
+			c.offsets.track(kafka.Message{Topic: "orders", Partition: 2, Offset: 11})
+			c.flush(context.Background(), []kafka.Message{m})
+
+			if len(svc.saves) != tt.wantSaves {
+				t.Fatalf("saves = %d, want %d", len(svc.saves), tt.wantSaves)
+			}
+			if len(parking.msgs) != 1 {
+				t.Fatalf("parked %d messages, want 1", len(parking.msgs))
+			}
+			if got := header(parking.msgs[0], HeaderAttempts); got != fmt.Sprint(tt.wantSaves) {
+				t.Fatalf("attempts header = %s, want %d", got, tt.wantSaves)
+			}
+			if len(r.commits) != 1 || r.commits[0].Partition != 2 || r.commits[0].Offset != 10 {
+				t.Fatalf("commits = %+v, want offset 10 of partition 2", r.commits)
+			}
+		})
+	}
+}
+
+func TestMessageIsNotCommittedUntilParked(t *testing.T) {
+	svc := &fakeService{results: []error{errors.New("constraint violated")}}
+	c, r, _, parking := newTestConsumer(svc)
+	parking.fails = 1 << 30
+
+	m := kafka.Message{Partition: 0, Offset: 3}
+	c.offsets.track(m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c.flush(ctx, []kafka.Message{m})
+
+	if len(r.commits) != 0 {
+		t.Fatalf("committed %+v although the message was never parked", r.commits)
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	bad := fmt.Errorf("%w: empty order_uid", service.ErrBadMessage)
+	dbDown := fmt.Errorf("%w: connection refused", infrastructure.ErrInternalDatabase)
+
+	tests := []struct {
+		name         string
+		batchResults []error
+		batchErr     error
+		// results answer the single saves after a failed batch.
+		results   []error
+		wantSaves []int64
+		// wantDLQ are the offsets sent to the dead-letter topic.
+		wantDLQ []int64
+	}{
+		{
+			name:         "all saved",
+			batchResults: []error{nil, nil, nil},
+		},
+		{
+			name:         "valid, stale and bad messages",
+			batchResults: []error{nil, service.ErrStaleEvent, bad},
+			wantDLQ:      []int64{12},
+		},
+		{
+			name:      "failed batch falls back to single messages",
+			batchErr:  dbDown,
+			results:   []error{nil},
+			wantSaves: []int64{10, 11, 12},
+		},
+		{
+			name:      "single fallback dead-letters the bad message only",
+			batchErr:  dbDown,
+			results:   []error{nil, bad, nil},
+			wantSaves: []int64{10, 11, 12},
+			wantDLQ:   []int64{11},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeService{batchResults: tt.batchResults, batchErr: tt.batchErr, results: tt.results}
+			c, r, dlq, _ := newTestConsumer(svc)
+			c.batchSize = 3
+
+			batch := make([]kafka.Message, 3)
+			for i := range batch {
+				batch[i] = kafka.Message{Topic: "orders", Partition: 0, Offset: int64(10 + i)}
+				c.offsets.track(batch[i])
+			}
+			c.flush(context.Background(), batch)
+
+			if svc.batches != 1 {
+				t.Fatalf("batches = %d, want 1", svc.batches)
+			}
+			if fmt.Sprint(svc.saves) != fmt.Sprint(tt.wantSaves) {
+				t.Fatalf("single saves = %v, want %v", svc.saves, tt.wantSaves)
+			}
+			dead := make([]int64, 0, len(dlq.msgs))
+			for _, m := range dlq.msgs {
+				var off int64
+				_, _ = fmt.Sscan(header(m, HeaderOriginalOffset), &off)
+				dead = append(dead, off)
+			}
+			if fmt.Sprint(dead) != fmt.Sprint(tt.wantDLQ) {
+				t.Fatalf("dead-lettered %v, want %v", dead, tt.wantDLQ)
+			}
+			if len(r.commits) != 1 || r.commits[0].Offset != 12 {
+				t.Fatalf("commits = %+v, want offset 12", r.commits)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderError             = "x-error"
+	HeaderFailedAt          = "x-failed-at"
+	HeaderAttempts          = "x-attempts"
+)
+
+func newWriter(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+}
+
+// failedMessage copies m for the dead-letter or parking topic and records
+// where it came from and why it was rejected, so it can be inspected and
+// re-driven.
+//
+// The value is copied as is, PII included, unlike what is stored in Postgres
+// or in the cache snapshot: it is the message as found on the source topic,
+// which holds the same plaintext, and re-driving needs it unchanged. The
+// dead-letter and parking topics need the access control and retention of
+// the source topic.
+func failedMessage(m kafka.Message, cause error, attempts int, now time.Time) kafka.Message {
+	headers := make([]kafka.Header, 0, len(m.Headers)+6)
+	headers = append(headers, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderFailedAt, Value: []byte(now.UTC().Format(time.RFC3339Nano))},
+		kafka.Header{Key: HeaderAttempts, Value: []byte(strconv.Itoa(attempts))},
+	)
+
+	return kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	}
+}
+
+func (c *Consumer) publishDeadLetter(ctx context.Context, m kafka.Message, cause error) error {
+	if err := c.dlq.WriteMessages(ctx, failedMessage(m, cause, 1, time.Now())); err != nil {
+		return err
+	}
+	if c.met != nil {
+		c.met.KafkaDLQ.Inc()
+	}
+	return nil
+}
+
+func (c *Consumer) park(ctx context.Context, m kafka.Message, cause error, attempts int) error {
+	if err := c.parking.WriteMessages(ctx, failedMessage(m, cause, attempts, time.Now())); err != nil {
+		return err
+	}
+	if c.met != nil {
+		c.met.KafkaParked.Inc()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package consumer
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker remembers fetched offsets per partition so that offsets are
+// only committed once every earlier message of the partition is processed,
+// even though workers may finish them out of order.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+	// targets holds, per partition, the latest message to commit that has
+	// not been handed to a commit yet.
+	targets    map[int]kafka.Message
+	committing bool
+}
+
+type partitionOffsets struct {
+	pending []int64
+	done    map[int64]kafka.Message
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[int]*partitionOffsets),
+		targets:    make(map[int]kafka.Message),
+	}
+}
+
+// track registers m as fetched. Messages must be tracked in fetch order.
+func (t *offsetTracker) track(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[m.Partition]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]kafka.Message)}
+		t.partitions[m.Partition] = p
+	}
+	p.pending = append(p.pending, m.Offset)
+}
+
+// complete marks m as processed and, if that moved it forward, makes the
+// highest message of the partition below which everything is processed the
+// commit target of the partition.
+func (t *offsetTracker) complete(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[m.Partition]
+	if !ok {
+		return
+	}
+	p.done[m.Offset] = m
+
+	for len(p.pending) > 0 {
+		dm, ok := p.done[p.pending[0]]
+		if !ok {
+			break
+		}
+		delete(p.done, p.pending[0])
+		p.pending = p.pending[1:]
+		t.targets[m.Partition] = dm
+	}
+}
+
+// commit calls fn with the current commit targets, outside the tracker lock.
+// Only one fn call runs at a time: if one is already running, commit returns
+// at once and the running caller picks up the targets set meanwhile, so that
+// the latest target of a partition wins and commits never go backwards.
+func (t *offsetTracker) commit(fn func(msgs ...kafka.Message)) {
+	for {
+		t.mu.Lock()
+		if t.committing || len(t.targets) == 0 {
+			t.mu.Unlock()
+			return
+		}
+		msgs := make([]kafka.Message, 0, len(t.targets))
+		for _, m := range t.targets {
+			msgs = append(msgs, m)
+		}
+		clear(t.targets)
+		t.committing = true
+		t.mu.Unlock()
+
+		fn(msgs...)
+
+		t.mu.Lock()
+		t.committing = false
+		t.mu.Unlock()
+	}
+}
@@ -0,0 +1,170 @@
+package consumer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type offset struct {
+	partition int
+	offset    int64
+}
+
+func msg(o offset) kafka.Message {
+	return kafka.Message{Partition: o.partition, Offset: o.offset}
+}
+
+func TestOffsetTrackerCommitsContiguousOffsets(t *testing.T) {
+	tests := []struct {
+		name     string
+		fetched  []offset
+		complete []offset
+		// want is the committed offset per partition after all completions.
+		want map[int]int64
+	}{
+		{
+			name:     "in order",
+			fetched:  []offset{{0, 1}, {0, 2}, {0, 3}},
+			complete: []offset{{0, 1}, {0, 2}, {0, 3}},
+			want:     map[int]int64{0: 3},
+		},
+		{
+			name:     "out of order",
+			fetched:  []offset{{0, 1}, {0, 2}, {0, 3}},
+			complete: []offset{{0, 3}, {0, 2}, {0, 1}},
+			want:     map[int]int64{0: 3},
+		},
+		{
+			name:     "gap holds back the commit",
+			fetched:  []offset{{0, 1}, {0, 2}, {0, 3}},
+			complete: []offset{{0, 1}, {0, 3}},
+			want:     map[int]int64{0: 1},
+		},
+		{
+			name:     "nothing contiguous",
+			fetched:  []offset{{0, 1}, {0, 2}},
+			complete: []offset{{0, 2}},
+			want:     map[int]int64{},
+		},
+		{
+			name:     "partitions are independent",
+			fetched:  []offset{{0, 1}, {1, 7}, {0, 2}, {1, 8}},
+			complete: []offset{{1, 8}, {0, 1}, {1, 7}},
+			want:     map[int]int64{0: 1, 1: 8},
+		},
+		{
+			name:     "offsets need not be dense",
+			fetched:  []offset{{0, 10}, {0, 15}, {0, 20}},
+			complete: []offset{{0, 20}, {0, 10}, {0, 15}},
+			want:     map[int]int64{0: 20},
+		},
+		{
+			name:     "untracked partition is ignored",
+			fetched:  []offset{{0, 1}},
+			complete: []offset{{3, 1}, {0, 1}},
+			want:     map[int]int64{0: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newOffsetTracker()
+			for _, o := range tt.fetched {
+				tr.track(msg(o))
+			}
+
+			got := make(map[int]int64)
+			for _, o := range tt.complete {
+				tr.complete(msg(o))
+				tr.commit(func(msgs ...kafka.Message) {
+					for _, m := range msgs {
+						if prev, ok := got[m.Partition]; ok && m.Offset <= prev {
+							t.Errorf("partition %d committed %d after %d", m.Partition, m.Offset, prev)
+						}
+						got[m.Partition] = m.Offset
+					}
+				})
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("committed %v, want %v", got, tt.want)
+			}
+			for p, off := range tt.want {
+				if got[p] != off {
+					t.Fatalf("committed %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOffsetTrackerCoalescesConcurrentCommits(t *testing.T) {
+	tr := newOffsetTracker()
+	for i := int64(1); i <= 3; i++ {
+		tr.track(msg(offset{0, i}))
+	}
+
+	var (
+		mu        sync.Mutex
+		committed []int64
+		running   int
+	)
+	release := make(chan struct{})
+	fn := func(msgs ...kafka.Message) {
+		mu.Lock()
+		running++
+		if running > 1 {
+			t.Error("commits ran concurrently")
+		}
+		first := len(committed) == 0
+		for _, m := range msgs {
+			committed = append(committed, m.Offset)
+		}
+		mu.Unlock()
+
+		if first {
+			<-release
+		}
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}
+
+	tr.complete(msg(offset{0, 1}))
+	done := make(chan struct{})
+	go func() {
+		tr.commit(fn)
+		close(done)
+	}()
+
+	// wait until the first commit blocks
+	for {
+		mu.Lock()
+		n := len(committed)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// both complete while the first commit is running; the call returns at
+	// once and the running one commits only the latest target
+	tr.complete(msg(offset{0, 2}))
+	tr.commit(fn)
+	tr.complete(msg(offset{0, 3}))
+	tr.commit(fn)
+
+	close(release)
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(committed) != 2 || committed[0] != 1 || committed[1] != 3 {
+		t.Fatalf("committed %v, want [1 3]", committed)
+	}
+}
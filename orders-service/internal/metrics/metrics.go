@@ -3,8 +3,24 @@ package metrics
 import "github.com/prometheus/client_golang/prometheus"
 
 type Metrics struct {
-	CacheHits   prometheus.Counter
-	CacheMisses prometheus.Counter
+	CacheHits      prometheus.Counter
+	CacheMisses    prometheus.Counter
+	CacheCoalesced prometheus.Counter
+
+	CacheEvictions *prometheus.CounterVec
+	CacheEntries   prometheus.Gauge
+	CacheBytes     prometheus.Gauge
+
+	CachePolicyRequests *prometheus.CounterVec
+
+	CacheInvalidations       *prometheus.CounterVec
+	CacheInvalidationResyncs prometheus.Counter
+
+	NegativeCacheHits   prometheus.Counter
+	NegativeCacheMisses prometheus.Counter
+
+	CacheWarmupLoaded   prometheus.Gauge
+	CacheWarmupDuration prometheus.Gauge
 
 	DBGetDuration  prometheus.Histogram
 	DBSaveDuration prometheus.Histogram
@@ -12,6 +28,17 @@ type Metrics struct {
 	KafkaMessages prometheus.Counter
 	KafkaBad      prometheus.Counter
 	KafkaErrors   prometheus.Counter
+	KafkaDLQ      prometheus.Counter
+	KafkaParked   prometheus.Counter
+	KafkaStale    prometheus.Counter
+
+	KafkaWorkers  prometheus.Gauge
+	KafkaInFlight prometheus.Gauge
+	KafkaBatch    prometheus.Histogram
+
+	ValidationRejections *prometheus.CounterVec
+
+	AuthRequests *prometheus.CounterVec
 }
 
 func New(reg prometheus.Registerer) *Metrics {
@@ -24,6 +51,50 @@ func New(reg prometheus.Registerer) *Metrics {
 			Name: "cache_misses_total",
 			Help: "Total cache misses",
 		}),
+		CacheCoalesced: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cache_coalesced_requests_total",
+			Help: "Total cache misses served by a database load started for another request",
+		}),
+		CacheEvictions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_evictions_total",
+			Help: "Total orders evicted from the cache, by reason",
+		}, []string{"reason"}),
+		CacheEntries: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cache_entries",
+			Help: "Orders currently held by the cache",
+		}),
+		CacheBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cache_bytes",
+			Help: "Estimated memory held by cached orders",
+		}),
+		CachePolicyRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_policy_requests_total",
+			Help: "Total cache lookups by eviction policy and result, for comparing hit ratios",
+		}, []string{"policy", "result"}),
+		CacheInvalidations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_invalidations_received_total",
+			Help: "Total order change notifications received from the database, by result",
+		}, []string{"result"}),
+		CacheInvalidationResyncs: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cache_invalidation_resyncs_total",
+			Help: "Total cache resyncs after the change notification connection was re-established",
+		}),
+		NegativeCacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "negative_cache_hits_total",
+			Help: "Total lookups answered as not found by the negative cache",
+		}),
+		NegativeCacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "negative_cache_misses_total",
+			Help: "Total cache misses not found in the negative cache",
+		}),
+		CacheWarmupLoaded: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cache_warmup_orders_loaded",
+			Help: "Orders loaded into the cache by the last warmup so far",
+		}),
+		CacheWarmupDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cache_warmup_duration_seconds",
+			Help: "Duration of the last completed cache warmup",
+		}),
 		DBGetDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
 			Name:    "db_get_order_duration_seconds",
 			Help:    "DB GetByID duration",
@@ -46,12 +117,52 @@ func New(reg prometheus.Registerer) *Metrics {
 			Name: "kafka_processing_errors_total",
 			Help: "Total Kafka processing errors (no commit)",
 		}),
+		KafkaDLQ: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kafka_dlq_messages_total",
+			Help: "Total Kafka messages published to the dead-letter topic",
+		}),
+		KafkaParked: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kafka_parked_messages_total",
+			Help: "Total Kafka messages parked after exhausting retry attempts",
+		}),
+		KafkaStale: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kafka_stale_messages_total",
+			Help: "Total Kafka messages skipped because a newer order version is stored",
+		}),
+		KafkaWorkers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kafka_consumer_workers",
+			Help: "Number of Kafka consumer workers",
+		}),
+		KafkaInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kafka_consumer_in_flight_messages",
+			Help: "Kafka messages fetched but not yet processed",
+		}),
+		KafkaBatch: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "kafka_batch_size",
+			Help:    "Number of Kafka messages flushed together",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		}),
+		ValidationRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "order_validation_rejections_total",
+			Help: "Total orders rejected by validation, by failed rule",
+		}, []string{"rule"}),
+		AuthRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_auth_requests_total",
+			Help: "Total requests to protected routes, by required permission and outcome",
+		}, []string{"permission", "result"}),
 	}
 
 	reg.MustRegister(
-		m.CacheHits, m.CacheMisses,
+		m.CacheHits, m.CacheMisses, m.CacheCoalesced,
+		m.CacheEvictions, m.CacheEntries, m.CacheBytes, m.CachePolicyRequests,
+		m.CacheInvalidations, m.CacheInvalidationResyncs,
+		m.NegativeCacheHits, m.NegativeCacheMisses,
+		m.CacheWarmupLoaded, m.CacheWarmupDuration,
 		m.DBGetDuration, m.DBSaveDuration,
-		m.KafkaMessages, m.KafkaBad, m.KafkaErrors,
+		m.KafkaMessages, m.KafkaBad, m.KafkaErrors, m.KafkaDLQ, m.KafkaParked, m.KafkaStale,
+		m.KafkaWorkers, m.KafkaInFlight, m.KafkaBatch,
+		m.ValidationRejections,
+		m.AuthRequests,
 	)
 	return m
 }
@@ -0,0 +1,116 @@
+package order_cache
+
+import (
+	"fmt"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
+	"math/rand/v2"
+	"strconv"
+	"testing"
+)
+
+// BenchmarkCache compares the cache implementations under parallel
+// read/write load:
+//
+//	go test ./orders-service/internal/order-cache -run '^$' -bench Cache -cpu 1,8
+func BenchmarkCache(b *testing.B) {
+	const (
+		keys   = 100_000
+		limit  = 50_000
+		shards = 16
+	)
+
+	ids := make([]string, keys)
+	orders := make([]entity.Order, keys)
+	for i := range ids {
+		ids[i] = "order-" + strconv.Itoa(i)
+		orders[i] = entity.Order{
+			OrderUID: ids[i],
+			Items:    []entity.Item{{ChrtID: int64(i), Name: "item"}},
+		}
+	}
+
+	caches := []struct {
+		name string
+		new  func() OrderCache
+	}{
+		{"lru", func() OrderCache {
+			return NewOrderCache(config.CacheConfig{Limit: limit}, nil)
+		}},
+		{fmt.Sprintf("sharded-%d", shards), func() OrderCache {
+			return NewShardedOrderCache(config.CacheConfig{Limit: limit, Shards: shards}, nil)
+		}},
+	}
+	mixes := []struct {
+		name     string
+		writePct int
+	}{
+		{"writes=10%", 10},
+		{"writes=50%", 50},
+	}
+
+	for _, mix := range mixes {
+		for _, impl := range caches {
+			b.Run(mix.name+"/"+impl.name, func(b *testing.B) {
+				c := impl.new()
+				for i := 0; i < limit; i++ {
+					c.Set(ids[i], &orders[i])
+				}
+
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+					for pb.Next() {
+						i := r.IntN(len(ids))
+						if r.IntN(100) < mix.writePct {
+							c.Set(ids[i], &orders[i])
+						} else {
+							c.Get(ids[i])
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkPolicyHitRatio replays a read-through trace where most lookups go
+// to a stable set of popular orders and the rest are one-off ids never seen
+// again, and reports the hit ratio of each eviction policy.
+func BenchmarkPolicyHitRatio(b *testing.B) {
+	const (
+		popular   = 100_000
+		limit     = 5_000
+		lookups   = 1_000_000
+		oneOffPct = 30
+	)
+
+	r := rand.New(rand.NewPCG(1, 2))
+	zipf := rand.NewZipf(r, 1.1, 1, popular-1)
+	trace := make([]string, lookups)
+	for i := range trace {
+		if r.IntN(100) < oneOffPct {
+			trace[i] = "once-" + strconv.Itoa(i)
+		} else {
+			trace[i] = "order-" + strconv.FormatUint(zipf.Uint64(), 10)
+		}
+	}
+
+	for _, policy := range []string{PolicyLRU, PolicyLFU, PolicyWTinyLFU} {
+		b.Run(policy, func(b *testing.B) {
+			hits, total := 0, 0
+			for n := 0; n < b.N; n++ {
+				c := NewOrderCache(config.CacheConfig{Limit: limit, Policy: policy}, nil)
+				for _, id := range trace {
+					total++
+					if _, ok := c.Get(id); ok {
+						hits++
+						continue
+					}
+					c.Set(id, &entity.Order{OrderUID: id})
+				}
+			}
+			b.ReportMetric(100*float64(hits)/float64(total), "hit%")
+		})
+	}
+}
@@ -1,39 +1,109 @@
 package order_cache
 
 import (
-	"container/list"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/metrics"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
 	"sync"
+	"time"
 )
 
 type OrderCache interface {
 	Get(id string) (*entity.Order, bool)
 	Set(id string, o *entity.Order)
+	// Invalidate drops the cached order id unless it is already at version
+	// or newer, and reports whether an entry was dropped.
+	Invalidate(id string, version int64) bool
+	// Orders returns copies of all orders currently cached.
+	Orders() []entity.Order
+	// Delete drops the cached order id and reports whether it was cached.
+	Delete(id string) bool
+	// Len returns the number of cached orders.
+	Len() int
+	// Purge drops all cached orders and returns how many there were.
+	Purge() int
+	Stats() Stats
 }
 
+// Stats describes the state of a cache since it was created.
+type Stats struct {
+	Policy   string `json:"policy"`
+	Entries  int    `json:"entries"`
+	Limit    int    `json:"limit"`
+	Bytes    int    `json:"bytes"`
+	MaxBytes int    `json:"max_bytes,omitempty"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	// Oldest is the order that has been cached the longest without being
+	// rewritten, if any.
+	Oldest *OldestEntry `json:"oldest,omitempty"`
+}
+
+type OldestEntry struct {
+	OrderUID string    `json:"order_uid"`
+	CachedAt time.Time `json:"cached_at"`
+}
+
+// HitRatio returns the share of lookups answered from the cache.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Eviction reasons reported in metrics.
+const (
+	EvictCapacity = "capacity"
+	EvictSize     = "size"
+	EvictTTL      = "ttl"
+	EvictInvalid  = "invalidated"
+	EvictManual   = "manual"
+)
+
+// OrderCacheImpl is a cache bounded by the number of entries and,
+// optionally, by their estimated size in bytes. Entries may also expire
+// after a TTL. Which entry is evicted first is decided by the configured
+// eviction policy (LRU by default).
 type OrderCacheImpl struct {
-	mu    sync.Mutex
-	limit int
+	mu       sync.Mutex
+	limit    int
+	maxBytes int
+	ttl      time.Duration
+	bytes    int
+	met      *metrics.Metrics
+	now      func() time.Time
+
+	policyName string
+	policy     evictionPolicy
+	m          map[string]*cacheEntry
 
-	ll *list.List
-	m  map[string]*list.Element
+	hits   uint64
+	misses uint64
 }
 
-type lruEntry struct {
-	key   string
-	order entity.Order
+type cacheEntry struct {
+	order     entity.Order
+	size      int
+	cachedAt  time.Time
+	expiresAt time.Time
 }
 
-func NewOrderCache(cfg config.CacheConfig) *OrderCacheImpl {
+func NewOrderCache(cfg config.CacheConfig, met *metrics.Metrics) *OrderCacheImpl {
 	limit := cfg.Limit
 	if limit <= 0 {
 		limit = 1000
 	}
+	name, policy := newPolicy(cfg.Policy, limit)
 	return &OrderCacheImpl{
-		limit: limit,
-		ll:    list.New(),
-		m:     make(map[string]*list.Element, limit),
+		limit:      limit,
+		maxBytes:   cfg.MaxBytes,
+		ttl:        cfg.TTL,
+		met:        met,
+		now:        time.Now,
+		policyName: name,
+		policy:     policy,
+		m:          make(map[string]*cacheEntry, limit),
 	}
 }
 
@@ -45,14 +115,21 @@ func (c *OrderCacheImpl) Get(id string) (*entity.Order, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if el, ok := c.m[id]; ok {
-		c.ll.MoveToFront(el)
+	if ent, ok := c.m[id]; ok {
+		if c.expired(ent) {
+			c.remove(id, EvictTTL)
+			c.countRequest(false)
+			return nil, false
+		}
 
-		ent := el.Value.(lruEntry)
+		c.policy.accessed(id)
+		c.countRequest(true)
 		o := ent.order
 		return &o, true
 	}
 
+	c.policy.missed(id)
+	c.countRequest(false)
 	return nil, false
 }
 
@@ -61,24 +138,184 @@ func (c *OrderCacheImpl) Set(id string, o *entity.Order) {
 		return
 	}
 
+	size := EstimateSize(o) + entryOverhead
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if el, ok := c.m[id]; ok {
-		el.Value = lruEntry{key: id, order: *o}
-		c.ll.MoveToFront(el)
+	if c.maxBytes > 0 && size > c.maxBytes {
+		// would evict everything else and still not fit; an older cached
+		// version must not outlive it either
+		if ent, ok := c.m[id]; ok && (c.expired(ent) || ent.order.Version <= o.Version) {
+			c.remove(id, EvictSize)
+		} else {
+			c.countEviction(EvictSize)
+		}
 		return
 	}
 
-	el := c.ll.PushFront(lruEntry{key: id, order: *o})
-	c.m[id] = el
+	now := c.now()
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = now.Add(c.ttl)
+	}
+
+	if ent, ok := c.m[id]; ok {
+		// never replace a cached order with an older version of it
+		if c.expired(ent) || ent.order.Version <= o.Version {
+			c.addBytes(size - ent.size)
+			*ent = cacheEntry{order: *o, size: size, cachedAt: now, expiresAt: expiresAt}
+		}
+		c.policy.accessed(id)
+	} else {
+		c.m[id] = &cacheEntry{order: *o, size: size, cachedAt: now, expiresAt: expiresAt}
+		c.policy.added(id)
+		c.addBytes(size)
+		if c.met != nil {
+			c.met.CacheEntries.Inc()
+		}
+	}
+
+	c.evict()
+}
+
+func (c *OrderCacheImpl) Invalidate(id string, version int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ent, ok := c.m[id]
+	if !ok || ent.order.Version >= version {
+		return false
+	}
+	c.remove(id, EvictInvalid)
+	return true
+}
+
+func (c *OrderCacheImpl) Orders() []entity.Order {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	orders := make([]entity.Order, 0, len(c.m))
+	for _, ent := range c.m {
+		if !c.expired(ent) {
+			orders = append(orders, ent.order)
+		}
+	}
+	return orders
+}
+
+func (c *OrderCacheImpl) Delete(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.m[id]; !ok {
+		return false
+	}
+	c.remove(id, EvictManual)
+	return true
+}
+
+func (c *OrderCacheImpl) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.m)
+}
+
+func (c *OrderCacheImpl) Purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.m)
+	for id := range c.m {
+		c.remove(id, EvictManual)
+	}
+	return n
+}
+
+func (c *OrderCacheImpl) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if c.ll.Len() > c.limit {
-		back := c.ll.Back()
-		if back != nil {
-			ent := back.Value.(lruEntry)
-			delete(c.m, ent.key)
-			c.ll.Remove(back)
+	st := Stats{
+		Policy:   c.policyName,
+		Entries:  len(c.m),
+		Limit:    c.limit,
+		Bytes:    c.bytes,
+		MaxBytes: c.maxBytes,
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+	for id, ent := range c.m {
+		if st.Oldest == nil || ent.cachedAt.Before(st.Oldest.CachedAt) {
+			st.Oldest = &OldestEntry{OrderUID: id, CachedAt: ent.cachedAt}
 		}
 	}
+	return st
+}
+
+// addBytes tracks the size change of the cache. Gauges are updated by delta
+// so that several caches (e.g. shards) can report into the same metrics.
+func (c *OrderCacheImpl) addBytes(n int) {
+	c.bytes += n
+	if c.met != nil {
+		c.met.CacheBytes.Add(float64(n))
+	}
+}
+
+// evict drops the victims chosen by the policy until the cache fits its
+// limits. Victims that have already expired are reported as TTL evictions.
+func (c *OrderCacheImpl) evict() {
+	for len(c.m) > c.limit && c.evictVictim(EvictCapacity) {
+	}
+	for c.maxBytes > 0 && c.bytes > c.maxBytes && c.evictVictim(EvictSize) {
+	}
+}
+
+func (c *OrderCacheImpl) evictVictim(reason string) bool {
+	id, ok := c.policy.victim()
+	if !ok {
+		return false
+	}
+	if c.expired(c.m[id]) {
+		reason = EvictTTL
+	}
+	c.remove(id, reason)
+	return true
+}
+
+func (c *OrderCacheImpl) remove(id string, reason string) {
+	ent := c.m[id]
+	delete(c.m, id)
+	c.policy.removed(id)
+	c.addBytes(-ent.size)
+	if c.met != nil {
+		c.met.CacheEntries.Dec()
+	}
+	c.countEviction(reason)
+}
+
+func (c *OrderCacheImpl) expired(ent *cacheEntry) bool {
+	return !ent.expiresAt.IsZero() && c.now().After(ent.expiresAt)
+}
+
+func (c *OrderCacheImpl) countEviction(reason string) {
+	if c.met != nil {
+		c.met.CacheEvictions.WithLabelValues(reason).Inc()
+	}
+}
+
+func (c *OrderCacheImpl) countRequest(hit bool) {
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	if c.met == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	c.met.CachePolicyRequests.WithLabelValues(c.policyName, result).Inc()
 }
@@ -0,0 +1,158 @@
+package order_cache
+
+import (
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func order(id string, version int64, pad int) *entity.Order {
+	return &entity.Order{OrderUID: id, Version: version, Entry: strings.Repeat("x", pad)}
+}
+
+func entrySize(o *entity.Order) int {
+	return EstimateSize(o) + entryOverhead
+}
+
+func TestCacheEvictsByCapacity(t *testing.T) {
+	tests := []struct {
+		policy string
+		// reads are the ids read after a, b and c were added to a cache of
+		// two entries; want is what is cached after d is added.
+		reads []string
+		want  []string
+	}{
+		{PolicyLRU, nil, []string{"c", "d"}},
+		{PolicyLRU, []string{"c", "c", "b"}, []string{"b", "d"}},
+		{PolicyLFU, []string{"c", "c", "c"}, []string{"c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			c := NewOrderCache(config.CacheConfig{Limit: 2, Policy: tt.policy}, nil)
+			for _, id := range []string{"a", "b", "c"} {
+				c.Set(id, order(id, 1, 0))
+			}
+			for _, id := range tt.reads {
+				c.Get(id)
+			}
+			c.Set("d", order("d", 1, 0))
+
+			if c.Len() != 2 {
+				t.Fatalf("len = %d, want 2", c.Len())
+			}
+			for _, id := range tt.want {
+				if _, ok := c.Get(id); !ok {
+					t.Fatalf("%s not cached", id)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheByteBudget(t *testing.T) {
+	small := entrySize(order("a", 1, 100))
+	budget := 3 * small
+
+	tests := []struct {
+		name string
+		sets []*entity.Order
+		// want are the cached ids with their versions.
+		want map[string]int64
+	}{
+		{
+			name: "fits",
+			sets: []*entity.Order{order("a", 1, 100), order("b", 1, 100), order("c", 1, 100)},
+			want: map[string]int64{"a": 1, "b": 1, "c": 1},
+		},
+		{
+			name: "oldest evicted to make room",
+			sets: []*entity.Order{order("a", 1, 100), order("b", 1, 100), order("c", 1, 100), order("d", 1, 100)},
+			want: map[string]int64{"b": 1, "c": 1, "d": 1},
+		},
+		{
+			name: "growing entry evicts others",
+			sets: []*entity.Order{order("a", 1, 100), order("b", 1, 100), order("b", 2, 100+small+small/2)},
+			want: map[string]int64{"b": 2},
+		},
+		{
+			name: "oversized order is not cached",
+			sets: []*entity.Order{order("a", 1, 100), order("b", 1, budget)},
+			want: map[string]int64{"a": 1},
+		},
+		{
+			name: "oversized newer version drops the cached one",
+			sets: []*entity.Order{order("a", 1, 100), order("b", 1, 100), order("a", 2, budget)},
+			want: map[string]int64{"b": 1},
+		},
+		{
+			name: "oversized older version keeps the cached one",
+			sets: []*entity.Order{order("a", 2, 100), order("a", 1, budget)},
+			want: map[string]int64{"a": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewOrderCache(config.CacheConfig{Limit: 100, MaxBytes: budget}, nil)
+			for _, o := range tt.sets {
+				c.Set(o.OrderUID, o)
+			}
+
+			if c.Len() != len(tt.want) {
+				t.Fatalf("len = %d, want %d", c.Len(), len(tt.want))
+			}
+			wantBytes := 0
+			for id, version := range tt.want {
+				o, ok := c.Get(id)
+				if !ok || o.Version != version {
+					t.Fatalf("%s: got %v, want version %d", id, o, version)
+				}
+				wantBytes += entrySize(o)
+			}
+			if st := c.Stats(); st.Bytes != wantBytes || st.Bytes > budget {
+				t.Fatalf("bytes = %d, want %d within %d", st.Bytes, wantBytes, budget)
+			}
+		})
+	}
+}
+
+func TestCacheKeepsNewerVersions(t *testing.T) {
+	c := NewOrderCache(config.CacheConfig{Limit: 10}, nil)
+	c.Set("a", order("a", 2, 0))
+	c.Set("a", order("a", 1, 0))
+
+	if o, _ := c.Get("a"); o.Version != 2 {
+		t.Fatalf("version = %d, want 2", o.Version)
+	}
+	if c.Invalidate("a", 2) {
+		t.Fatal("invalidated by the cached version")
+	}
+	if !c.Invalidate("a", 3) {
+		t.Fatal("not invalidated by a newer version")
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("still cached after invalidation")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Now()
+	c := NewOrderCache(config.CacheConfig{Limit: 10, TTL: time.Minute}, nil)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", order("a", 1, 0))
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("not cached")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("served after TTL")
+	}
+	if c.Stats().Bytes != 0 {
+		t.Fatalf("bytes = %d after expiry, want 0", c.Stats().Bytes)
+	}
+}
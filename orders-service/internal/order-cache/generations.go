@@ -0,0 +1,60 @@
+package order_cache
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const genBuckets = 1024
+
+// Generations counts changes of orders per id hash bucket, so that a load
+// from the database can tell whether the order changed while it ran and its
+// result, an order or its absence, must not be cached. The zero value is
+// ready to use.
+type Generations struct {
+	mu   sync.Mutex
+	gens [genBuckets]uint64
+}
+
+func genBucket(id string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum32() % genBuckets)
+}
+
+// Get returns a token to pass to IfCurrent for a load of id starting now.
+func (g *Generations) Get(id string) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.gens[genBucket(id)]
+}
+
+// Bump records a change of id. Loads of id that started before are no longer
+// current once Bump returns.
+func (g *Generations) Bump(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gens[genBucket(id)]++
+}
+
+// BumpAll records a change of every order.
+func (g *Generations) BumpAll() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range g.gens {
+		g.gens[i]++
+	}
+}
+
+// IfCurrent calls fn, typically caching the result of a load of id, unless
+// id changed since gen was taken, and reports whether it did. fn runs under
+// the lock of g, so that no change is recorded meanwhile.
+func (g *Generations) IfCurrent(id string, gen uint64, fn func()) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.gens[genBucket(id)] != gen {
+		return false
+	}
+	fn()
+	return true
+}
@@ -0,0 +1,129 @@
+package order_cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// NegativeCache remembers ids of orders that do not exist for a short TTL.
+// When it is full, the entry closest to expiry makes room for a new one.
+type NegativeCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	limit int
+	m     map[string]*list.Element
+	// ll holds the entries by expiry, soonest first. All entries live for
+	// the same TTL, so this is the order in which they were added.
+	ll *list.List
+	// gens are shared with the order cache, so that a lookup that started
+	// before an order was stored cannot mark it as missing afterwards.
+	gens *Generations
+	now  func() time.Time
+}
+
+// NewNegativeCache returns a cache holding up to limit ids for ttl each,
+// which only adds ids that did not change in gens since their lookup
+// started. A non-positive ttl disables it.
+func NewNegativeCache(ttl time.Duration, limit int, gens *Generations) *NegativeCache {
+	if limit <= 0 {
+		limit = 1000
+	}
+	return &NegativeCache{
+		ttl:   ttl,
+		limit: limit,
+		m:     make(map[string]*list.Element),
+		ll:    list.New(),
+		gens:  gens,
+		now:   time.Now,
+	}
+}
+
+func (c *NegativeCache) Enabled() bool {
+	return c != nil && c.ttl > 0
+}
+
+type negativeEntry struct {
+	id      string
+	expires time.Time
+}
+
+// Has reports whether id is known not to exist.
+func (c *NegativeCache) Has(id string) bool {
+	if !c.Enabled() {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.m[id]
+	if !ok {
+		return false
+	}
+	if c.now().After(el.Value.(*negativeEntry).expires) {
+		c.remove(el)
+		return false
+	}
+	return true
+}
+
+// Add marks id as missing unless it changed since gen was taken from the
+// generations of the cache.
+func (c *NegativeCache) Add(id string, gen uint64) {
+	if !c.Enabled() {
+		return
+	}
+	c.gens.IfCurrent(id, gen, func() { c.add(id) })
+}
+
+func (c *NegativeCache) add(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if el, ok := c.m[id]; ok {
+		el.Value.(*negativeEntry).expires = now.Add(c.ttl)
+		c.ll.MoveToBack(el)
+		return
+	}
+
+	// expired entries are at the front; drop them, and the entry expiring
+	// next if there is still no room
+	for el := c.ll.Front(); el != nil && (len(c.m) >= c.limit || now.After(el.Value.(*negativeEntry).expires)); el = c.ll.Front() {
+		c.remove(el)
+	}
+	c.m[id] = c.ll.PushBack(&negativeEntry{id: id, expires: now.Add(c.ttl)})
+}
+
+// Delete forgets id, typically because the order has just been stored. The
+// generation of id must be bumped first, so that lookups in flight do not
+// add it again.
+func (c *NegativeCache) Delete(id string) {
+	if !c.Enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.m[id]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge forgets all ids. Like for Delete, all generations must be bumped
+// first.
+func (c *NegativeCache) Purge() {
+	if !c.Enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.m)
+	c.ll.Init()
+}
+
+func (c *NegativeCache) remove(el *list.Element) {
+	delete(c.m, c.ll.Remove(el).(*negativeEntry).id)
+}
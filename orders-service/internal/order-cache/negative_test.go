@@ -0,0 +1,98 @@
+package order_cache
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNegativeCacheLimit(t *testing.T) {
+	type step struct {
+		// add is added, or time advances by wait if add is empty
+		add  string
+		wait time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+		want  []string
+	}{
+		{
+			name:  "below limit",
+			steps: []step{{add: "a"}, {add: "b"}},
+			want:  []string{"a", "b"},
+		},
+		{
+			name:  "oldest makes room",
+			steps: []step{{add: "a"}, {add: "b"}, {add: "c"}, {add: "d"}},
+			want:  []string{"b", "c", "d"},
+		},
+		{
+			name:  "re-added id is kept longer",
+			steps: []step{{add: "a"}, {add: "b"}, {add: "c"}, {add: "a"}, {add: "d"}},
+			want:  []string{"a", "c", "d"},
+		},
+		{
+			name:  "expired ids are dropped first",
+			steps: []step{{add: "a"}, {add: "b"}, {wait: 6 * time.Second}, {add: "c"}, {add: "d"}},
+			want:  []string{"c", "d"},
+		},
+		{
+			name:  "expired ids are dropped below limit",
+			steps: []step{{add: "a"}, {wait: 6 * time.Second}, {add: "b"}},
+			want:  []string{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			gens := &Generations{}
+			c := NewNegativeCache(5*time.Second, 3, gens)
+			c.now = func() time.Time { return now }
+
+			for _, s := range tt.steps {
+				if s.add == "" {
+					now = now.Add(s.wait)
+					continue
+				}
+				c.Add(s.add, gens.Get(s.add))
+			}
+
+			got := make([]string, 0, len(c.m))
+			for id := range c.m {
+				got = append(got, id)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) || c.ll.Len() != len(c.m) {
+				t.Fatalf("held %v (list %d), want %v", got, c.ll.Len(), tt.want)
+			}
+			for _, id := range tt.want {
+				if !c.Has(id) {
+					t.Fatalf("Has(%q) = false", id)
+				}
+			}
+		})
+	}
+}
+
+func TestNegativeCacheSkipsChangedIDs(t *testing.T) {
+	gens := &Generations{}
+	c := NewNegativeCache(time.Minute, 10, gens)
+
+	gen := gens.Get("a")
+	gens.Bump("a")
+	c.Add("a", gen)
+	if c.Has("a") {
+		t.Fatal("id changed during its lookup was added")
+	}
+
+	c.Add("a", gens.Get("a"))
+	gens.Bump("a")
+	c.Delete("a")
+	if c.Has("a") || len(c.m) != 0 || c.ll.Len() != 0 {
+		t.Fatal("deleted id still held")
+	}
+}
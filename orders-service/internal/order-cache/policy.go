@@ -0,0 +1,166 @@
+package order_cache
+
+import (
+	"container/list"
+	"strings"
+)
+
+// Eviction policies selectable with CACHE_POLICY.
+const (
+	PolicyLRU      = "lru"
+	PolicyLFU      = "lfu"
+	PolicyWTinyLFU = "wtinylfu"
+)
+
+// evictionPolicy decides which key the cache drops when it is over its
+// limits. The cache owns the entries and calls the policy under its lock.
+type evictionPolicy interface {
+	// added registers a key that was just inserted.
+	added(key string)
+	// accessed records a read or update of a cached key.
+	accessed(key string)
+	// missed records a lookup of a key that is not cached.
+	missed(key string)
+	// removed forgets a key, whatever the reason.
+	removed(key string)
+	// victim returns the key to evict next, or false if there is none.
+	victim() (string, bool)
+}
+
+// newPolicy returns the policy named by name, falling back to LRU for
+// unknown names, together with its canonical name.
+func newPolicy(name string, limit int) (string, evictionPolicy) {
+	switch strings.ToLower(name) {
+	case PolicyLFU:
+		return PolicyLFU, newLFU()
+	case PolicyWTinyLFU, "w-tinylfu", "tinylfu":
+		return PolicyWTinyLFU, newWTinyLFU(limit)
+	default:
+		return PolicyLRU, newLRU()
+	}
+}
+
+// lruPolicy evicts the least recently used key.
+type lruPolicy struct {
+	ll *list.List
+	m  map[string]*list.Element
+}
+
+func newLRU() *lruPolicy {
+	return &lruPolicy{ll: list.New(), m: make(map[string]*list.Element)}
+}
+
+func (p *lruPolicy) added(key string) {
+	p.m[key] = p.ll.PushFront(key)
+}
+
+func (p *lruPolicy) accessed(key string) {
+	if el, ok := p.m[key]; ok {
+		p.ll.MoveToFront(el)
+	}
+}
+
+func (p *lruPolicy) missed(string) {}
+
+func (p *lruPolicy) removed(key string) {
+	if el, ok := p.m[key]; ok {
+		p.ll.Remove(el)
+		delete(p.m, key)
+	}
+}
+
+func (p *lruPolicy) victim() (string, bool) {
+	back := p.ll.Back()
+	if back == nil {
+		return "", false
+	}
+	return back.Value.(string), true
+}
+
+// lfuPolicy evicts the least frequently used key, the least recently used
+// one among equally frequent keys. All operations are O(1).
+type lfuPolicy struct {
+	m       map[string]*lfuNode
+	buckets map[int]*list.List
+	minFreq int
+}
+
+type lfuNode struct {
+	freq int
+	el   *list.Element
+}
+
+func newLFU() *lfuPolicy {
+	return &lfuPolicy{m: make(map[string]*lfuNode), buckets: make(map[int]*list.List)}
+}
+
+func (p *lfuPolicy) bucket(freq int) *list.List {
+	b, ok := p.buckets[freq]
+	if !ok {
+		b = list.New()
+		p.buckets[freq] = b
+	}
+	return b
+}
+
+func (p *lfuPolicy) added(key string) {
+	p.m[key] = &lfuNode{freq: 1, el: p.bucket(1).PushFront(key)}
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy) accessed(key string) {
+	n, ok := p.m[key]
+	if !ok {
+		return
+	}
+
+	old := p.buckets[n.freq]
+	old.Remove(n.el)
+	if old.Len() == 0 {
+		delete(p.buckets, n.freq)
+		if p.minFreq == n.freq {
+			p.minFreq++
+		}
+	}
+
+	n.freq++
+	n.el = p.bucket(n.freq).PushFront(key)
+}
+
+func (p *lfuPolicy) missed(string) {}
+
+func (p *lfuPolicy) removed(key string) {
+	n, ok := p.m[key]
+	if !ok {
+		return
+	}
+	delete(p.m, key)
+
+	b := p.buckets[n.freq]
+	b.Remove(n.el)
+	if b.Len() == 0 {
+		delete(p.buckets, n.freq)
+		if p.minFreq == n.freq {
+			p.recomputeMin()
+		}
+	}
+}
+
+// recomputeMin is only needed after removals, which may empty the lowest
+// bucket without a key moving to the next one.
+func (p *lfuPolicy) recomputeMin() {
+	p.minFreq = 0
+	for f := range p.buckets {
+		if p.minFreq == 0 || f < p.minFreq {
+			p.minFreq = f
+		}
+	}
+}
+
+func (p *lfuPolicy) victim() (string, bool) {
+	b, ok := p.buckets[p.minFreq]
+	if !ok || b.Len() == 0 {
+		return "", false
+	}
+	return b.Back().Value.(string), true
+}
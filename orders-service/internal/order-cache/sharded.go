@@ -0,0 +1,117 @@
+package order_cache
+
+import (
+	"hash/maphash"
+
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/metrics"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
+)
+
+// ShardedOrderCache splits the key space over independent caches, each with
+// its own lock, so that reads of different orders do not contend. Eviction
+// order, entry limit and byte budget are kept per shard, which makes them
+// approximate for the cache as a whole.
+type ShardedOrderCache struct {
+	seed   maphash.Seed
+	shards []*OrderCacheImpl
+}
+
+func NewShardedOrderCache(cfg config.CacheConfig, met *metrics.Metrics) *ShardedOrderCache {
+	n := cfg.Shards
+	if n <= 0 {
+		n = 1
+	}
+
+	shardCfg := cfg
+	limit := cfg.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	shardCfg.Limit = max(1, (limit+n-1)/n)
+	if cfg.MaxBytes > 0 {
+		shardCfg.MaxBytes = max(1, cfg.MaxBytes/n)
+	}
+
+	c := &ShardedOrderCache{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*OrderCacheImpl, n),
+	}
+	for i := range c.shards {
+		c.shards[i] = NewOrderCache(shardCfg, met)
+	}
+	return c
+}
+
+func (c *ShardedOrderCache) shard(id string) *OrderCacheImpl {
+	return c.shards[maphash.String(c.seed, id)%uint64(len(c.shards))]
+}
+
+func (c *ShardedOrderCache) Get(id string) (*entity.Order, bool) {
+	return c.shard(id).Get(id)
+}
+
+func (c *ShardedOrderCache) Set(id string, o *entity.Order) {
+	c.shard(id).Set(id, o)
+}
+
+func (c *ShardedOrderCache) Invalidate(id string, version int64) bool {
+	return c.shard(id).Invalidate(id, version)
+}
+
+func (c *ShardedOrderCache) Orders() []entity.Order {
+	var orders []entity.Order
+	for _, s := range c.shards {
+		orders = append(orders, s.Orders()...)
+	}
+	return orders
+}
+
+func (c *ShardedOrderCache) Delete(id string) bool {
+	return c.shard(id).Delete(id)
+}
+
+func (c *ShardedOrderCache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.Len()
+	}
+	return n
+}
+
+func (c *ShardedOrderCache) Purge() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.Purge()
+	}
+	return n
+}
+
+// Stats sums the stats of all shards.
+func (c *ShardedOrderCache) Stats() Stats {
+	var st Stats
+	for _, s := range c.shards {
+		ss := s.Stats()
+		st.Policy = ss.Policy
+		st.Entries += ss.Entries
+		st.Limit += ss.Limit
+		st.Bytes += ss.Bytes
+		st.MaxBytes += ss.MaxBytes
+		st.Hits += ss.Hits
+		st.Misses += ss.Misses
+		if ss.Oldest != nil && (st.Oldest == nil || ss.Oldest.CachedAt.Before(st.Oldest.CachedAt)) {
+			st.Oldest = ss.Oldest
+		}
+	}
+	return st
+}
+
+// New returns the OrderCache implementation selected by cfg: a sharded cache
+// when more than one shard is configured, a single cache otherwise. Either
+// way entries are evicted by the policy named by cfg.Policy.
+func New(cfg config.CacheConfig, met *metrics.Metrics) OrderCache {
+	if cfg.Shards > 1 {
+		return NewShardedOrderCache(cfg, met)
+	}
+	return NewOrderCache(cfg, met)
+}
@@ -0,0 +1,37 @@
+package order_cache
+
+import (
+	"unsafe"
+
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+)
+
+// entryOverhead approximates the policy bookkeeping, map slot and key an
+// entry costs on top of the order itself.
+const entryOverhead = 128
+
+var (
+	orderSize = int(unsafe.Sizeof(entity.Order{}))
+	itemSize  = int(unsafe.Sizeof(entity.Item{}))
+)
+
+// EstimateSize approximates the memory footprint of o in bytes: the fixed
+// size of the structs plus the bytes of every string they reference.
+func EstimateSize(o *entity.Order) int {
+	n := orderSize +
+		len(o.OrderUID) + len(o.TrackNumber) + len(o.Entry) + len(o.Locale) +
+		len(o.InternalSignature) + len(o.CustomerID) + len(o.DeliveryService) +
+		len(o.ShardKey) + len(o.OofShard)
+
+	d := o.Delivery
+	n += len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) + len(d.Address) + len(d.Region) + len(d.Email)
+
+	p := o.Payment
+	n += len(p.Transaction) + len(p.RequestID) + len(p.Currency) + len(p.Provider) + len(p.Bank)
+
+	n += cap(o.Items) * itemSize
+	for _, it := range o.Items {
+		n += len(it.TrackNumber) + len(it.Rid) + len(it.Name) + len(it.Size) + len(it.Brand)
+	}
+	return n
+}
@@ -0,0 +1,119 @@
+package order_cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/fieldcrypt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotFormat = 1
+
+// snapshotAAD binds encrypted snapshots to their purpose.
+const snapshotAAD = "cache-snapshot"
+
+var ErrBadSnapshot = errors.New("bad cache snapshot")
+
+type snapshotFile struct {
+	Format  int             `json:"format"`
+	TakenAt time.Time       `json:"taken_at"`
+	Orders  []snapshotEntry `json:"orders,omitempty"`
+	// Sealed holds the orders encrypted, instead of Orders, when the
+	// snapshot was written with an encryptor.
+	Sealed string `json:"sealed,omitempty"`
+}
+
+type snapshotEntry struct {
+	Order     entity.Order `json:"order"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// WriteSnapshot stores orders in the file at path, encrypted with enc unless
+// it is nil, since cached orders hold customer PII. The file is replaced
+// atomically, so a crash while writing leaves the previous snapshot intact.
+func WriteSnapshot(ctx context.Context, path string, orders []entity.Order, enc *fieldcrypt.Encryptor) error {
+	snap := snapshotFile{
+		Format:  snapshotFormat,
+		TakenAt: time.Now(),
+		Orders:  make([]snapshotEntry, len(orders)),
+	}
+	for i, o := range orders {
+		snap.Orders[i] = snapshotEntry{Order: o, UpdatedAt: o.UpdatedAt}
+	}
+
+	if enc != nil {
+		plain, err := json.Marshal(snap.Orders)
+		if err != nil {
+			return err
+		}
+		if snap.Sealed, err = enc.Encrypt(ctx, string(plain), snapshotAAD); err != nil {
+			return fmt.Errorf("encrypt snapshot: %w", err)
+		}
+		snap.Orders = nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := json.NewEncoder(tmp).Encode(snap); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadSnapshot returns the orders stored by WriteSnapshot, decrypting them
+// with enc. It returns an error wrapping os.ErrNotExist if there is no
+// snapshot and ErrBadSnapshot if it cannot be decoded or decrypted.
+func ReadSnapshot(ctx context.Context, path string, enc *fieldcrypt.Encryptor) ([]entity.Order, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var snap snapshotFile
+	if err := json.NewDecoder(f).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadSnapshot, err)
+	}
+	if snap.Format != snapshotFormat {
+		return nil, fmt.Errorf("%w: unknown format %d", ErrBadSnapshot, snap.Format)
+	}
+	if snap.Sealed != "" {
+		if enc == nil {
+			return nil, fmt.Errorf("%w: encrypted, but no key configured", ErrBadSnapshot)
+		}
+		plain, err := enc.Decrypt(ctx, snap.Sealed, snapshotAAD)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBadSnapshot, err)
+		}
+		if err := json.Unmarshal([]byte(plain), &snap.Orders); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBadSnapshot, err)
+		}
+	}
+
+	orders := make([]entity.Order, 0, len(snap.Orders))
+	for _, e := range snap.Orders {
+		if e.Order.OrderUID == "" {
+			return nil, fmt.Errorf("%w: order without order_uid", ErrBadSnapshot)
+		}
+		e.Order.UpdatedAt = e.UpdatedAt
+		orders = append(orders, e.Order)
+	}
+	return orders, nil
+}
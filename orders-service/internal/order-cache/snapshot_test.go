@@ -0,0 +1,96 @@
+package order_cache
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/fieldcrypt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEncryptor(t *testing.T) *fieldcrypt.Encryptor {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	if err := os.WriteFile(path, []byte(`{"current":"k1","keys":{"k1":"`+key+`"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kp, err := fieldcrypt.LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fieldcrypt.NewEncryptor(kp)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	enc := testEncryptor(t)
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	orders := []entity.Order{{
+		OrderUID:  "a",
+		Version:   3,
+		Delivery:  entity.Delivery{Name: "Test Testov", Phone: "+9720000000"},
+		UpdatedAt: updated,
+	}}
+
+	tests := []struct {
+		name       string
+		writeWith  *fieldcrypt.Encryptor
+		readWith   *fieldcrypt.Encryptor
+		wantErr    error
+		wantSealed bool
+	}{
+		{"plaintext", nil, nil, nil, false},
+		{"encrypted", enc, enc, nil, true},
+		{"plaintext read with key", nil, enc, nil, false},
+		{"encrypted read without key", enc, nil, ErrBadSnapshot, true},
+		{"encrypted read with other key", enc, testEncryptorOtherKey(t), ErrBadSnapshot, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cache.json")
+			if err := WriteSnapshot(ctx, path, orders, tt.writeWith); err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if leaked := strings.Contains(string(raw), "Test Testov"); leaked == tt.wantSealed {
+				t.Fatalf("plaintext PII in file = %v, want %v", leaked, !tt.wantSealed)
+			}
+
+			got, err := ReadSnapshot(ctx, path, tt.readWith)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("read error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got) != 1 || got[0].Delivery.Name != "Test Testov" || got[0].Version != 3 || !got[0].UpdatedAt.Equal(updated) {
+				t.Fatalf("read %+v", got)
+			}
+		})
+	}
+}
+
+func testEncryptorOtherKey(t *testing.T) *fieldcrypt.Encryptor {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	if err := os.WriteFile(path, []byte(`{"current":"k1","keys":{"k1":"`+key+`"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kp, err := fieldcrypt.LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fieldcrypt.NewEncryptor(kp)
+}
@@ -0,0 +1,240 @@
+package order_cache
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+// wTinyLFUPolicy implements W-TinyLFU: new keys enter a small LRU window and,
+// when pushed out of it, compete for a place in the main segmented LRU
+// against its eviction candidate. The winner is the key with the higher
+// estimated access frequency, so one-off lookups do not flush popular
+// orders out of the cache.
+type wTinyLFUPolicy struct {
+	sketch *countMinSketch
+	m      map[string]*list.Element
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+
+	windowCap    int
+	protectedCap int
+
+	// candidate is the last key moved from the window to probation; it is
+	// the one that has to beat the main victim on the next eviction.
+	candidate string
+}
+
+type segment uint8
+
+const (
+	segWindow segment = iota
+	segProbation
+	segProtected
+)
+
+type tinyLFUEntry struct {
+	key string
+	seg segment
+}
+
+func newWTinyLFU(limit int) *wTinyLFUPolicy {
+	windowCap := limit / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	mainCap := limit - windowCap
+	return &wTinyLFUPolicy{
+		sketch:       newCountMinSketch(limit),
+		m:            make(map[string]*list.Element),
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		windowCap:    windowCap,
+		protectedCap: mainCap * 80 / 100,
+	}
+}
+
+func (p *wTinyLFUPolicy) list(s segment) *list.List {
+	switch s {
+	case segProbation:
+		return p.probation
+	case segProtected:
+		return p.protected
+	default:
+		return p.window
+	}
+}
+
+func (p *wTinyLFUPolicy) added(key string) {
+	p.sketch.increment(key)
+	p.m[key] = p.window.PushFront(&tinyLFUEntry{key: key, seg: segWindow})
+
+	if p.window.Len() > p.windowCap {
+		back := p.window.Back()
+		ent := back.Value.(*tinyLFUEntry)
+		p.window.Remove(back)
+		ent.seg = segProbation
+		p.m[ent.key] = p.probation.PushFront(ent)
+		p.candidate = ent.key
+	}
+}
+
+func (p *wTinyLFUPolicy) accessed(key string) {
+	p.sketch.increment(key)
+
+	el, ok := p.m[key]
+	if !ok {
+		return
+	}
+	ent := el.Value.(*tinyLFUEntry)
+
+	switch ent.seg {
+	case segWindow:
+		p.window.MoveToFront(el)
+	case segProtected:
+		p.protected.MoveToFront(el)
+	case segProbation:
+		p.probation.Remove(el)
+		ent.seg = segProtected
+		p.m[key] = p.protected.PushFront(ent)
+		if p.candidate == key {
+			p.candidate = ""
+		}
+
+		if p.protected.Len() > p.protectedCap {
+			back := p.protected.Back()
+			demoted := back.Value.(*tinyLFUEntry)
+			p.protected.Remove(back)
+			demoted.seg = segProbation
+			p.m[demoted.key] = p.probation.PushFront(demoted)
+		}
+	}
+}
+
+func (p *wTinyLFUPolicy) missed(key string) {
+	p.sketch.increment(key)
+}
+
+func (p *wTinyLFUPolicy) removed(key string) {
+	el, ok := p.m[key]
+	if !ok {
+		return
+	}
+	p.list(el.Value.(*tinyLFUEntry).seg).Remove(el)
+	delete(p.m, key)
+	if p.candidate == key {
+		p.candidate = ""
+	}
+}
+
+func (p *wTinyLFUPolicy) victim() (string, bool) {
+	main, ok := p.mainVictim()
+
+	if p.candidate != "" {
+		candidate := p.candidate
+		p.candidate = ""
+		if !ok {
+			return candidate, true
+		}
+		if p.sketch.estimate(candidate) > p.sketch.estimate(main) {
+			return main, true
+		}
+		return candidate, true
+	}
+
+	if ok {
+		return main, true
+	}
+	if back := p.window.Back(); back != nil {
+		return back.Value.(*tinyLFUEntry).key, true
+	}
+	return "", false
+}
+
+// mainVictim returns the least recently used key of the main segment other
+// than the current candidate.
+func (p *wTinyLFUPolicy) mainVictim() (string, bool) {
+	for _, l := range []*list.List{p.probation, p.protected} {
+		for el := l.Back(); el != nil; el = el.Prev() {
+			if key := el.Value.(*tinyLFUEntry).key; key != p.candidate {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// countMinSketch estimates access frequencies of keys in a fixed amount of
+// memory. Counters are periodically halved so that the estimates follow
+// recent popularity rather than all-time counts.
+type countMinSketch struct {
+	seed       maphash.Seed
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	resetAfter int
+}
+
+const (
+	sketchDepth  = 4
+	sketchMaxCnt = 15
+)
+
+func newCountMinSketch(limit int) *countMinSketch {
+	width := 16
+	for width < limit {
+		width <<= 1
+	}
+
+	s := &countMinSketch{
+		seed:       maphash.MakeSeed(),
+		mask:       uint64(width - 1),
+		resetAfter: 10 * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(h uint64, row int) uint64 {
+	lo, hi := h&0xffffffff, h>>32
+	return (lo + uint64(row)*hi) & s.mask
+}
+
+func (s *countMinSketch) increment(key string) {
+	h := maphash.String(s.seed, key)
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < sketchMaxCnt {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAfter {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	h := maphash.String(s.seed, key)
+	est := uint8(sketchMaxCnt)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < est {
+			est = v
+		}
+	}
+	return est
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,104 @@
+package order_cache
+
+import (
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
+	"strconv"
+	"testing"
+)
+
+// widenSketch makes frequency estimates of a W-TinyLFU cache exact for the
+// few keys of a test. The sketch is sized for the cache limit and has a
+// random seed, so colliding keys would make results vary between runs.
+func widenSketch(c *OrderCacheImpl) {
+	if p, ok := c.policy.(*wTinyLFUPolicy); ok {
+		p.sketch = newCountMinSketch(1 << 16)
+	}
+}
+
+func TestWTinyLFUKeepsHotOrdersDuringScans(t *testing.T) {
+	tests := []struct {
+		policy string
+		// wantKept is the number of hot orders still cached after a scan of
+		// orders that are read once.
+		wantKept int
+	}{
+		{PolicyWTinyLFU, 50},
+		// LRU has no defense against scans; it shows that the scan is
+		// long enough to flush the cache
+		{PolicyLRU, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			c := NewOrderCache(config.CacheConfig{Limit: 100, Policy: tt.policy}, nil)
+			widenSketch(c)
+
+			hot := make([]string, 50)
+			for i := range hot {
+				hot[i] = "hot-" + strconv.Itoa(i)
+				c.Set(hot[i], order(hot[i], 1, 0))
+			}
+			// moves the last hot order out of the window too
+			c.Set("filler", order("filler", 1, 0))
+			for range 5 {
+				for _, id := range hot {
+					c.Get(id)
+				}
+			}
+
+			for i := range 1000 {
+				id := "scan-" + strconv.Itoa(i)
+				c.Get(id)
+				c.Set(id, order(id, 1, 0))
+			}
+
+			kept := 0
+			for _, id := range hot {
+				if _, ok := c.Get(id); ok {
+					kept++
+				}
+			}
+			if kept != tt.wantKept {
+				t.Fatalf("kept %d of %d hot orders, want %d", kept, len(hot), tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestWTinyLFUAdmission(t *testing.T) {
+	tests := []struct {
+		name string
+		// lookups are the misses of the newcomer before it is cached.
+		lookups  int
+		wantKept bool
+	}{
+		{"seen once", 0, false},
+		{"seen often", 5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewOrderCache(config.CacheConfig{Limit: 10, Policy: PolicyWTinyLFU}, nil)
+			widenSketch(c)
+			for i := range 10 {
+				id := "cold-" + strconv.Itoa(i)
+				c.Set(id, order(id, 1, 0))
+			}
+
+			for range tt.lookups {
+				c.Get("new")
+			}
+			c.Set("new", order("new", 1, 0))
+			// pushes the newcomer out of the window, where it has to beat
+			// the eviction candidate of the main segment
+			c.Set("next", order("next", 1, 0))
+
+			if c.Len() != 10 {
+				t.Fatalf("len = %d, want 10", c.Len())
+			}
+			if _, kept := c.m["new"]; kept != tt.wantKept {
+				t.Fatalf("newcomer kept = %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
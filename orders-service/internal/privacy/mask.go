@@ -0,0 +1,59 @@
+package privacy
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const maskRune = '*'
+
+// maskPhone keeps the country code prefix and the last two digits:
+// "+79001234512" becomes "+7********12".
+func maskPhone(s string) string {
+	r := []rune(s)
+	keepHead := 1
+	if len(r) > 0 && r[0] == '+' {
+		keepHead = 2
+	}
+	if len(r) <= keepHead+2 {
+		return strings.Repeat(string(maskRune), len(r))
+	}
+	for i := keepHead; i < len(r)-2; i++ {
+		r[i] = maskRune
+	}
+	return string(r)
+}
+
+// maskEmail keeps the first letter of the local part and the domain:
+// "alice@example.com" becomes "a***@example.com".
+func maskEmail(s string) string {
+	local, domain, ok := strings.Cut(s, "@")
+	if !ok || local == "" {
+		return maskWords(s)
+	}
+	first, _ := utf8.DecodeRuneInString(local)
+	return string(first) + "***@" + domain
+}
+
+// maskWords keeps the first letter of every word: "Test Testov" becomes
+// "T*** T***".
+func maskWords(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		first, _ := utf8.DecodeRuneInString(w)
+		words[i] = string(first) + "***"
+	}
+	return strings.Join(words, " ")
+}
+
+// maskTail returns a mask keeping the last n characters of values longer
+// than 2n.
+func maskTail(n int) func(string) string {
+	return func(s string) string {
+		r := []rune(s)
+		if len(r) <= 2*n {
+			return strings.Repeat(string(maskRune), len(r))
+		}
+		return strings.Repeat(string(maskRune), len(r)-n) + string(r[len(r)-n:])
+	}
+}
@@ -0,0 +1,146 @@
+package privacy
+
+import (
+	"fmt"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"sort"
+	"strings"
+)
+
+// Action is what a projection does with a field.
+type Action string
+
+const (
+	Show Action = "show"
+	Mask Action = "mask"
+	Hide Action = "hide"
+)
+
+type field struct {
+	get  func(o *entity.Order) *string
+	mask func(s string) string
+}
+
+// fields are the PII fields a policy can act on, by JSON path.
+var fields = map[string]field{
+	"delivery.name":       {func(o *entity.Order) *string { return &o.Delivery.Name }, maskWords},
+	"delivery.phone":      {func(o *entity.Order) *string { return &o.Delivery.Phone }, maskPhone},
+	"delivery.zip":        {func(o *entity.Order) *string { return &o.Delivery.Zip }, maskTail(2)},
+	"delivery.city":       {func(o *entity.Order) *string { return &o.Delivery.City }, maskWords},
+	"delivery.address":    {func(o *entity.Order) *string { return &o.Delivery.Address }, maskWords},
+	"delivery.region":     {func(o *entity.Order) *string { return &o.Delivery.Region }, maskWords},
+	"delivery.email":      {func(o *entity.Order) *string { return &o.Delivery.Email }, maskEmail},
+	"payment.transaction": {func(o *entity.Order) *string { return &o.Payment.Transaction }, maskTail(4)},
+	"payment.request_id":  {func(o *entity.Order) *string { return &o.Payment.RequestID }, maskTail(4)},
+	"payment.provider":    {func(o *entity.Order) *string { return &o.Payment.Provider }, maskWords},
+	"payment.bank":        {func(o *entity.Order) *string { return &o.Payment.Bank }, maskWords},
+}
+
+// Policy says what to do with each PII field, by JSON path. Fields that are
+// not listed are shown.
+type Policy map[string]Action
+
+// DefaultPolicy masks contact details and payment identifiers enough to
+// recognise them, e.g. when a customer calls support, but not to use them.
+func DefaultPolicy() Policy {
+	return Policy{
+		"delivery.name":       Mask,
+		"delivery.phone":      Mask,
+		"delivery.zip":        Mask,
+		"delivery.address":    Mask,
+		"delivery.email":      Mask,
+		"payment.transaction": Mask,
+		"payment.request_id":  Mask,
+		"payment.bank":        Hide,
+	}
+}
+
+// ParsePolicy returns base overridden by spec, a comma-separated list of
+// field=action pairs such as "delivery.city=mask,payment.bank=show".
+func ParsePolicy(base Policy, spec string) (Policy, error) {
+	p := make(Policy, len(base))
+	for k, v := range base {
+		p[k] = v
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, action, ok := strings.Cut(pair, "=")
+		name, action = strings.TrimSpace(name), strings.TrimSpace(action)
+		if !ok {
+			return nil, fmt.Errorf("privacy policy: %q is not field=action", pair)
+		}
+		if _, known := fields[name]; !known {
+			return nil, fmt.Errorf("privacy policy: unknown field %q, known are %s", name, knownFields())
+		}
+		switch a := Action(action); a {
+		case Show, Mask, Hide:
+			p[name] = a
+		default:
+			return nil, fmt.Errorf("privacy policy: unknown action %q for %s", action, name)
+		}
+	}
+	return p, nil
+}
+
+func knownFields() string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Restricts reports whether the policy masks or hides field, a JSON path.
+func (p Policy) Restricts(field string) bool {
+	a, ok := p[field]
+	return ok && a != Show
+}
+
+// Order returns o projected by the policy. o itself is not modified.
+func (p Policy) Order(o entity.Order) entity.Order {
+	for name, action := range p {
+		f, ok := fields[name]
+		if !ok {
+			continue
+		}
+		v := f.get(&o)
+		*v = apply(action, f, *v)
+	}
+	return o
+}
+
+// Changes returns the changes with the values of PII fields projected.
+func (p Policy) Changes(changes []entity.FieldChange) []entity.FieldChange {
+	out := make([]entity.FieldChange, len(changes))
+	for i, c := range changes {
+		if f, ok := fields[c.Field]; ok {
+			c.From = applyAny(p[c.Field], f, c.From)
+			c.To = applyAny(p[c.Field], f, c.To)
+		}
+		out[i] = c
+	}
+	return out
+}
+
+func apply(action Action, f field, v string) string {
+	switch action {
+	case Mask:
+		return f.mask(v)
+	case Hide:
+		return ""
+	default:
+		return v
+	}
+}
+
+func applyAny(action Action, f field, v any) any {
+	if s, ok := v.(string); ok {
+		return apply(action, f, s)
+	}
+	return v
+}
@@ -0,0 +1,128 @@
+package privacy
+
+import (
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"testing"
+)
+
+func TestMasks(t *testing.T) {
+	tests := []struct {
+		name string
+		mask func(string) string
+		in   string
+		want string
+	}{
+		{"phone", maskPhone, "+79001234512", "+7********12"},
+		{"phone without plus", maskPhone, "89001234512", "8********12"},
+		{"short phone", maskPhone, "+712", "****"},
+		{"email", maskEmail, "alice@example.com", "a***@example.com"},
+		{"not an email", maskEmail, "alice example", "a*** e***"},
+		{"words", maskWords, "Test Testov", "T*** T***"},
+		{"cyrillic words", maskWords, "Иван Иванов", "И*** И***"},
+		{"tail", maskTail(4), "b563feb7b2b84b6test", "***************test"},
+		{"short tail", maskTail(4), "12345678", "********"},
+		{"empty", maskPhone, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mask(tt.in); got != tt.want {
+				t.Fatalf("mask(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyOrder(t *testing.T) {
+	o := entity.Order{
+		OrderUID: "b563feb7b2b84b6test",
+		Delivery: entity.Delivery{Name: "Test Testov", Phone: "+9720000000", City: "Kiryat Mozkin"},
+		Payment:  entity.Payment{Bank: "alpha"},
+	}
+
+	tests := []struct {
+		name      string
+		spec      string
+		wantName  string
+		wantPhone string
+		wantCity  string
+		wantBank  string
+	}{
+		{"default", "", "T*** T***", "+9*******00", "Kiryat Mozkin", ""},
+		{"overridden", "delivery.city=mask,payment.bank=show,delivery.name=hide", "", "+9*******00", "K*** M***", "alpha"},
+		{"show all", "delivery.name=show,delivery.phone=show", "Test Testov", "+9720000000", "Kiryat Mozkin", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePolicy(DefaultPolicy(), tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := p.Order(o)
+			if got.Delivery.Name != tt.wantName || got.Delivery.Phone != tt.wantPhone ||
+				got.Delivery.City != tt.wantCity || got.Payment.Bank != tt.wantBank {
+				t.Fatalf("projected %+v %+v", got.Delivery, got.Payment)
+			}
+			if got.OrderUID != o.OrderUID || o.Delivery.Name != "Test Testov" {
+				t.Fatal("projection changed more than the PII fields")
+			}
+		})
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	for _, spec := range []string{
+		"delivery.name",
+		"delivery.nickname=mask",
+		"delivery.name=blur",
+	} {
+		if _, err := ParsePolicy(DefaultPolicy(), spec); err == nil {
+			t.Errorf("ParsePolicy(%q) did not fail", spec)
+		}
+	}
+}
+
+func TestPolicyChanges(t *testing.T) {
+	changes := []entity.FieldChange{
+		{Field: "delivery.phone", From: "+9720000000", To: "+9720000099"},
+		{Field: "amount", From: 10, To: 20},
+	}
+
+	got := DefaultPolicy().Changes(changes)
+	if got[0].From != "+9*******00" || got[0].To != "+9*******99" {
+		t.Fatalf("phone change = %+v", got[0])
+	}
+	if got[1] != changes[1] {
+		t.Fatalf("non-PII change = %+v", got[1])
+	}
+	if changes[0].From != "+9720000000" {
+		t.Fatal("input changes modified")
+	}
+}
+
+func TestPolicyRestricts(t *testing.T) {
+	p, err := ParsePolicy(DefaultPolicy(), "payment.provider=mask,delivery.name=show")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"payment.bank", true},
+		{"payment.provider", true},
+		{"delivery.phone", true},
+		{"delivery.name", false},
+		{"delivery.city", false},
+	}
+	for _, tt := range tests {
+		if got := p.Restricts(tt.field); got != tt.want {
+			t.Errorf("Restricts(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+	if Policy(nil).Restricts("payment.bank") {
+		t.Error("nil policy restricts payment.bank")
+	}
+}
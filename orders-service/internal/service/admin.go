@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+	oc "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/order-cache"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// adminWarmupTimeout bounds a warmup started by StartWarmup.
+const adminWarmupTimeout = 10 * time.Minute
+
+var ErrWarmupRunning = errors.New("cache warmup already running")
+
+func (s *Service) CacheStats() oc.Stats {
+	return s.cache.Stats()
+}
+
+// EvictOrder drops id from the cache and reports whether it was cached.
+func (s *Service) EvictOrder(id string) bool {
+	s.changed(id)
+	ok := s.cache.Delete(id)
+	s.logger.Info("order evicted from cache", zap.String("order_uid", id), zap.Bool("cached", ok))
+	return ok
+}
+
+// FlushCache empties the cache and returns the number of dropped orders.
+func (s *Service) FlushCache() int {
+	s.gens.BumpAll()
+	s.negative.Purge()
+	n := s.cache.Purge()
+	s.logger.Info("cache flushed", zap.Int("count", n))
+	return n
+}
+
+// StartWarmup loads up to limit most recently updated orders into the cache
+// in the background. It returns ErrWarmupRunning if a warmup started this way
+// has not finished yet.
+func (s *Service) StartWarmup(limit int) error {
+	if !s.warming.CompareAndSwap(false, true) {
+		return ErrWarmupRunning
+	}
+
+	go func() {
+		defer s.warming.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), adminWarmupTimeout)
+		defer cancel()
+		_, _ = s.warmup(ctx, limit)
+	}()
+	return nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure"
+	"go.uber.org/zap"
+)
+
+// OrderHistory lists the accepted revisions of an order, oldest first. It
+// returns infrastructure.ErrOrderNotFound for unknown orders; orders stored
+// before revisions were recorded have an empty history.
+func (s *Service) OrderHistory(ctx context.Context, id string) ([]entity.OrderRevision, error) {
+	revs, err := s.repo.ListRevisions(ctx, id)
+	if err != nil {
+		s.logger.Error("list order revisions failed", zap.String("order_uid", id), zap.Error(err))
+		return nil, err
+	}
+	if len(revs) > 0 {
+		return revs, nil
+	}
+
+	updated, err := s.repo.UpdatedAt(ctx, []string{id})
+	if err != nil {
+		s.logger.Error("check order existence failed", zap.String("order_uid", id), zap.Error(err))
+		return nil, err
+	}
+	if _, ok := updated[id]; !ok {
+		return nil, infrastructure.ErrOrderNotFound
+	}
+	return revs, nil
+}
+
+// OrderRevision returns the snapshot of an order as of revision revID.
+func (s *Service) OrderRevision(ctx context.Context, id string, revID int64) (*entity.OrderRevision, error) {
+	rev, err := s.repo.GetRevision(ctx, id, revID)
+	if err != nil {
+		s.logger.Error("get order revision failed",
+			zap.String("order_uid", id),
+			zap.Int64("revision", revID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	return rev, nil
+}
+
+// DiffRevisions returns the fields that differ between two revisions of an
+// order, sorted by field path.
+func (s *Service) DiffRevisions(ctx context.Context, id string, fromID, toID int64) ([]entity.FieldChange, error) {
+	from, err := s.OrderRevision(ctx, id, fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.OrderRevision(ctx, id, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffOrders(from.Order, to.Order)
+}
+
+// diffOrders returns the fields that differ between from and to, sorted by
+// field path.
+func diffOrders(from, to *entity.Order) ([]entity.FieldChange, error) {
+	fromFields, err := flattenOrder(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := flattenOrder(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]entity.FieldChange, 0)
+	for field, v := range fromFields {
+		if w, ok := toFields[field]; !ok || !reflect.DeepEqual(v, w) {
+			changes = append(changes, entity.FieldChange{Field: field, From: v, To: toFields[field]})
+		}
+	}
+	for field, w := range toFields {
+		if _, ok := fromFields[field]; !ok {
+			changes = append(changes, entity.FieldChange{Field: field, To: w})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// flattenOrder maps the dotted JSON path of every leaf value of o to the value.
+// Items are addressed by their chrt_id, e.g. "items[chrt_id=42].price", so
+// that adding or removing an item does not shift the paths of the others.
+// Versions taken from the broker are left out, like in order responses.
+func flattenOrder(o *entity.Order) (map[string]any, error) {
+	shown := *o
+	shown.Version = entity.ProducerVersion(shown.Version)
+	raw, err := json.Marshal(&shown)
+	if err != nil {
+		return nil, fmt.Errorf("marshal order: %w", err)
+	}
+	var tree any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return nil, fmt.Errorf("unmarshal order: %w", err)
+	}
+
+	out := make(map[string]any)
+	flatten("", tree, out)
+	return out, nil
+}
+
+func flatten(prefix string, v any, out map[string]any) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flatten(key, child, out)
+		}
+	case []any:
+		for i, child := range t {
+			flatten(prefix+"["+elementKey(i, child)+"]", child, out)
+		}
+	default:
+		out[prefix] = t
+	}
+}
+
+// elementKey identifies an element of an array: objects with a chrt_id by it,
+// anything else by its index.
+func elementKey(i int, v any) string {
+	if m, ok := v.(map[string]any); ok {
+		if id, ok := m["chrt_id"].(json.Number); ok {
+			return "chrt_id=" + id.String()
+		}
+	}
+	return strconv.Itoa(i)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDiffOrdersMatchesItemsByChrtID(t *testing.T) {
+	item := func(chrtID int64, price int) entity.Item {
+		return entity.Item{ChrtID: chrtID, Name: "item", Price: price}
+	}
+	order := func(items ...entity.Item) *entity.Order {
+		return &entity.Order{OrderUID: "a", Items: items}
+	}
+
+	tests := []struct {
+		name string
+		from *entity.Order
+		to   *entity.Order
+		// want are the changed items, and the field for changed ones.
+		want []string
+	}{
+		{
+			name: "unchanged",
+			from: order(item(1, 10), item(2, 20)),
+			to:   order(item(1, 10), item(2, 20)),
+			want: []string{},
+		},
+		{
+			name: "item inserted in front",
+			from: order(item(1, 10), item(2, 20)),
+			to:   order(item(3, 30), item(1, 10), item(2, 20)),
+			want: []string{"items[chrt_id=3]"},
+		},
+		{
+			name: "item removed",
+			from: order(item(1, 10), item(2, 20)),
+			to:   order(item(2, 20)),
+			want: []string{"items[chrt_id=1]"},
+		},
+		{
+			name: "item changed and reordered",
+			from: order(item(1, 10), item(2, 20)),
+			to:   order(item(2, 25), item(1, 10)),
+			want: []string{"items[chrt_id=2].price"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := diffOrders(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			seen := make(map[string]bool)
+			for _, c := range changes {
+				field := c.Field
+				if c.From == nil || c.To == nil {
+					// the whole item was added or removed
+					field, _, _ = strings.Cut(field, "].")
+					field += "]"
+				}
+				seen[field] = true
+			}
+			got := make([]string, 0, len(seen))
+			for f := range seen {
+				got = append(got, f)
+			}
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("changes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffOrdersHidesBrokerVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int64
+		want     []entity.FieldChange
+	}{
+		{"broker versions", entity.BrokerVersionBase + 1, entity.BrokerVersionBase + 2, nil},
+		{"broker to explicit version", entity.BrokerVersionBase + 1, 3, []entity.FieldChange{{Field: "version", From: nil, To: json.Number("3")}}},
+		{"explicit versions", 2, 3, []entity.FieldChange{{Field: "version", From: json.Number("2"), To: json.Number("3")}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := diffOrders(&entity.Order{OrderUID: "a", Version: tt.from}, &entity.Order{OrderUID: "a", Version: tt.to})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != len(tt.want) || (len(changes) > 0 && !reflect.DeepEqual(changes, tt.want)) {
+				t.Fatalf("changes = %+v, want %+v", changes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+
+	"go.uber.org/zap"
+)
+
+// InvalidateOrder handles an order stored by this or another instance. The
+// cached copy is dropped unless it is already at the stored version, so the
+// next read loads the order from the database.
+func (s *Service) InvalidateOrder(ch entity.OrderChange) {
+	s.changed(ch.OrderUID)
+
+	result := "ignored"
+	if s.cache.Invalidate(ch.OrderUID, ch.Version) {
+		result = "evicted"
+		s.logger.Debug("cached order invalidated",
+			zap.String("order_uid", ch.OrderUID),
+			zap.Int64("version", ch.Version),
+		)
+	}
+	if s.met != nil {
+		s.met.CacheInvalidations.WithLabelValues(result).Inc()
+	}
+}
+
+// ResyncCache refreshes the cache after change notifications may have been
+// missed. Warmup reloads the most recently updated orders, which are the ones
+// that can have changed meanwhile, and replaces older cached versions.
+func (s *Service) ResyncCache(ctx context.Context) {
+	if s.met != nil {
+		s.met.CacheInvalidationResyncs.Inc()
+	}
+	if err := s.WarmupCache(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		s.logger.Error("cache resync failed", zap.Error(err))
+	}
+}
@@ -6,15 +6,24 @@ import (
 	"errors"
 	"fmt"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/fieldcrypt"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure"
 	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/metrics"
 	oc "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/order-cache"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/validation"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"sync/atomic"
 	"time"
 )
 
+// loadTimeout bounds a database load shared by coalesced requests.
+const loadTimeout = 5 * time.Second
+
 var (
 	ErrBadMessage = errors.New("bad message")
+	ErrStaleEvent = errors.New("stale event")
 )
 
 type Service struct {
@@ -23,72 +32,229 @@ type Service struct {
 	logger           *zap.Logger
 	met              *metrics.Metrics
 	cacheWarmupLimit int
+	cacheWarmupChunk int
+	validator        *validation.Validator
+	loads            singleflight.Group
+	negative         *oc.NegativeCache
+	gens             *oc.Generations
+	snapshotPath     string
+	enc              *fieldcrypt.Encryptor
+	warming          atomic.Bool
 }
 
-func New(repo infrastructure.Repository, cache oc.OrderCache, logger *zap.Logger, warmupLimit int, met *metrics.Metrics) *Service {
+// New returns a service caching orders from repo. Cache snapshots are
+// encrypted with enc unless it is nil.
+func New(repo infrastructure.Repository, cache oc.OrderCache, logger *zap.Logger, cfg config.CacheConfig, met *metrics.Metrics, validator *validation.Validator, enc *fieldcrypt.Encryptor) *Service {
+	warmupLimit := cfg.Limit
 	if warmupLimit <= 0 {
 		warmupLimit = 1000
 	}
+	warmupChunk := cfg.WarmupChunk
+	if warmupChunk <= 0 {
+		warmupChunk = 1000
+	}
+	gens := &oc.Generations{}
 	return &Service{
 		repo:             repo,
 		cache:            cache,
 		logger:           logger,
 		met:              met,
 		cacheWarmupLimit: warmupLimit,
+		cacheWarmupChunk: warmupChunk,
+		validator:        validator,
+		gens:             gens,
+		negative:         oc.NewNegativeCache(cfg.NegativeTTL, warmupLimit, gens),
+		snapshotPath:     cfg.Snapshot,
+		enc:              enc,
 	}
 }
 
+// WarmupCache fills the cache with the most recently updated orders, loading
+// them from the database in chunks and logging progress after each chunk.
 func (s *Service) WarmupCache(ctx context.Context) error {
-	orders, err := s.repo.LoadRecent(ctx, s.cacheWarmupLimit)
+	_, err := s.warmup(ctx, s.cacheWarmupLimit)
+	return err
+}
+
+func (s *Service) warmup(ctx context.Context, limit int) (int, error) {
+	start := time.Now()
+	loaded := 0
+	if s.met != nil {
+		s.met.CacheWarmupLoaded.Set(0)
+	}
+
+	err := s.repo.LoadRecent(ctx, limit, s.cacheWarmupChunk, func(orders []entity.Order) error {
+		for i := range orders {
+			o := orders[i]
+			s.cache.Set(o.OrderUID, &o)
+		}
+		loaded += len(orders)
+
+		if s.met != nil {
+			s.met.CacheWarmupLoaded.Set(float64(loaded))
+		}
+		s.logger.Info("cache warmup progress",
+			zap.Int("loaded", loaded),
+			zap.Int("limit", limit),
+		)
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("warmup cache failed", zap.Int("loaded", loaded), zap.Error(err))
+		return loaded, err
+	}
+
+	if s.met != nil {
+		s.met.CacheWarmupDuration.Set(time.Since(start).Seconds())
+	}
+	s.logger.Info("cache warmed", zap.Int("count", loaded), zap.Duration("took", time.Since(start)))
+	return loaded, nil
+}
+
+// SaveOrderFromEvent stores the order carried by ev. It returns
+// ErrStaleEvent without touching the database or the cache if a same or
+// newer version of the order is already stored.
+func (s *Service) SaveOrderFromEvent(ctx context.Context, ev entity.OrderEvent) error {
+	o, err := s.decodeOrder(ev)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err = s.repo.Save(ctx, o, eventSource(ev))
+	if s.met != nil {
+		s.met.DBSaveDuration.Observe(time.Since(start).Seconds())
+	}
+	if errors.Is(err, infrastructure.ErrStaleVersion) {
+		s.logger.Info("stale order event skipped",
+			zap.String("order_uid", o.OrderUID),
+			zap.Int64("version", o.Version),
+		)
+		return ErrStaleEvent
+	}
 	if err != nil {
-		s.logger.Error("warmup cache failed", zap.Error(err))
+		if s.met != nil {
+			s.met.KafkaErrors.Inc()
+		}
+		s.logger.Error("save order failed", zap.String("order_uid", o.OrderUID), zap.Error(err))
 		return err
 	}
-	for i := range orders {
-		o := orders[i]
-		s.cache.Set(o.OrderUID, &o)
+
+	if s.met != nil {
+		s.met.KafkaMessages.Inc()
 	}
-	s.logger.Info("cache warmed", zap.Int("count", len(orders)))
+
+	s.changed(o.OrderUID)
+	s.cache.Set(o.OrderUID, o)
+	s.logger.Info("order saved", zap.String("order_uid", o.OrderUID))
 	return nil
 }
 
-func (s *Service) SaveOrderFromEvent(ctx context.Context, msg []byte) error {
+// SaveOrdersFromEvents stores the orders of all well-formed events in one
+// transaction. The returned slice has an ErrBadMessage error at the index of
+// each event that could not be decoded, ErrStaleEvent for each event that
+// was older than the stored order and nil for the saved ones. If the batch
+// itself cannot be saved, none of the orders are stored and the error is
+// returned.
+func (s *Service) SaveOrdersFromEvents(ctx context.Context, evs []entity.OrderEvent) ([]error, error) {
+	errs := make([]error, len(evs))
+	orders := make([]*entity.Order, 0, len(evs))
+	srcs := make([]entity.EventSource, 0, len(evs))
+	idx := make([]int, 0, len(evs))
+	for i, ev := range evs {
+		o, err := s.decodeOrder(ev)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		orders = append(orders, o)
+		srcs = append(srcs, eventSource(ev))
+		idx = append(idx, i)
+	}
+
+	start := time.Now()
+	saveErrs, err := s.repo.SaveBatch(ctx, orders, srcs)
+	if s.met != nil {
+		s.met.DBSaveDuration.Observe(time.Since(start).Seconds())
+	}
+	if err != nil {
+		if s.met != nil {
+			s.met.KafkaErrors.Inc()
+		}
+		s.logger.Error("save order batch failed", zap.Int("count", len(orders)), zap.Error(err))
+		return nil, err
+	}
+
+	saved := 0
+	for k, o := range orders {
+		if errors.Is(saveErrs[k], infrastructure.ErrStaleVersion) {
+			errs[idx[k]] = ErrStaleEvent
+			continue
+		}
+		s.changed(o.OrderUID)
+		s.cache.Set(o.OrderUID, o)
+		saved++
+	}
+
+	if s.met != nil {
+		s.met.KafkaMessages.Add(float64(saved))
+	}
+	s.logger.Info("order batch saved", zap.Int("count", saved))
+	return errs, nil
+}
+
+func eventSource(ev entity.OrderEvent) entity.EventSource {
+	return entity.EventSource{
+		Topic:      ev.Topic,
+		Partition:  ev.Partition,
+		Offset:     ev.Offset,
+		ReceivedAt: time.Now().UTC(),
+	}
+}
+
+// decodeOrder parses and validates the order of ev. Explicit versions must be
+// positive; orders without one are versioned by the Kafka message timestamp,
+// or by the offset if the message has no timestamp, shifted by
+// entity.BrokerVersionBase.
+func (s *Service) decodeOrder(ev entity.OrderEvent) (*entity.Order, error) {
 	var o entity.Order
-	if err := json.Unmarshal(msg, &o); err != nil {
+	if err := json.Unmarshal(ev.Payload, &o); err != nil {
 		if s.met != nil {
 			s.met.KafkaBad.Inc()
 		}
 		s.logger.Warn("bad message: json unmarshal", zap.Error(err))
-		return fmt.Errorf("%w: %v", ErrBadMessage, err)
+		return nil, fmt.Errorf("%w: %v", ErrBadMessage, err)
 	}
 	if o.OrderUID == "" {
 		if s.met != nil {
 			s.met.KafkaBad.Inc()
 		}
 		s.logger.Warn("bad message: empty order_uid")
-		return fmt.Errorf("%w: empty order_uid", ErrBadMessage)
+		return nil, fmt.Errorf("%w: empty order_uid", ErrBadMessage)
+	}
+	if s.validator != nil {
+		if err := s.validator.Validate(&o); err != nil {
+			s.countRejections(err)
+			s.logger.Warn("bad message: validation", zap.String("order_uid", o.OrderUID), zap.Error(err))
+			return nil, fmt.Errorf("%w: %w", ErrBadMessage, err)
+		}
 	}
 	if o.DateCreated.IsZero() {
 		o.DateCreated = time.Now().UTC()
 	}
-	start := time.Now()
-	if err := s.repo.Save(ctx, &o); err != nil {
+	switch {
+	case o.Version < 0:
 		if s.met != nil {
-			s.met.DBSaveDuration.Observe(time.Since(start).Seconds())
-			s.met.KafkaErrors.Inc()
+			s.met.KafkaBad.Inc()
 		}
-		s.logger.Error("save order failed", zap.String("order_uid", o.OrderUID), zap.Error(err))
-		return err
-	}
-
-	if s.met != nil {
-		s.met.DBSaveDuration.Observe(time.Since(start).Seconds())
-		s.met.KafkaMessages.Inc()
+		s.logger.Warn("bad message: negative version", zap.String("order_uid", o.OrderUID), zap.Int64("version", o.Version))
+		return nil, fmt.Errorf("%w: negative version", ErrBadMessage)
+	case o.Version == 0 && !ev.Timestamp.IsZero():
+		o.Version = entity.BrokerVersionBase + ev.Timestamp.UnixMilli()
+	case o.Version == 0:
+		o.Version = entity.BrokerVersionBase + ev.Offset
 	}
-
-	s.cache.Set(o.OrderUID, &o)
-	s.logger.Info("order saved", zap.String("order_uid", o.OrderUID))
-	return nil
+	return &o, nil
 }
 
 func (s *Service) GetOrder(ctx context.Context, id string) (*entity.Order, error) {
@@ -103,15 +269,174 @@ func (s *Service) GetOrder(ctx context.Context, id string) (*entity.Order, error
 	}
 	s.logger.Debug("cache miss", zap.String("order_uid", id))
 
+	if s.negative.Enabled() {
+		if s.negative.Has(id) {
+			if s.met != nil {
+				s.met.NegativeCacheHits.Inc()
+			}
+			return nil, infrastructure.ErrOrderNotFound
+		}
+		if s.met != nil {
+			s.met.NegativeCacheMisses.Inc()
+		}
+	}
+
+	// Concurrent misses for the same id share a single database query. The
+	// query is detached from the caller that started it, so one canceled
+	// request does not fail the others waiting for it.
+	leader := false
+	ch := s.loads.DoChan(id, func() (any, error) {
+		leader = true
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		return s.loadOrder(loadCtx, id)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if !leader && s.met != nil {
+			s.met.CacheCoalesced.Inc()
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		o := *res.Val.(*entity.Order)
+		return &o, nil
+	}
+}
+
+// loadOrder reads the order from the database and caches it, unless it was
+// saved or invalidated meanwhile: the row read may then be older than the
+// one stored.
+func (s *Service) loadOrder(ctx context.Context, id string) (*entity.Order, error) {
+	gen := s.gens.Get(id)
+
 	start := time.Now()
 	o, err := s.repo.GetByID(ctx, id)
 	if s.met != nil {
 		s.met.DBGetDuration.Observe(time.Since(start).Seconds())
 	}
+	if errors.Is(err, infrastructure.ErrOrderNotFound) {
+		s.negative.Add(id, gen)
+		s.logger.Debug("order not found", zap.String("order_uid", id))
+		return nil, err
+	}
 	if err != nil {
 		s.logger.Error("get order from db failed", zap.String("order_uid", id), zap.Error(err))
 		return nil, err
 	}
-	s.cache.Set(id, o)
+	s.cacheLoaded(o, gen)
 	return o, nil
 }
+
+// changed records that the order id was stored or dropped: loads of it that
+// started before can neither cache it nor mark it as missing.
+func (s *Service) changed(id string) {
+	s.gens.Bump(id)
+	s.negative.Delete(id)
+}
+
+// cacheLoaded caches o, read from the database, unless it changed since gen
+// was taken.
+func (s *Service) cacheLoaded(o *entity.Order, gen uint64) {
+	if !s.gens.IfCurrent(o.OrderUID, gen, func() { s.cache.Set(o.OrderUID, o) }) {
+		s.logger.Debug("order changed while loading, not cached", zap.String("order_uid", o.OrderUID))
+	}
+}
+
+func (s *Service) countRejections(err error) {
+	if s.met == nil {
+		return
+	}
+	s.met.KafkaBad.Inc()
+
+	var verrs validation.Errors
+	if !errors.As(err, &verrs) {
+		return
+	}
+	seen := make(map[string]struct{}, len(verrs))
+	for _, fe := range verrs {
+		if _, ok := seen[fe.Rule]; ok {
+			continue
+		}
+		seen[fe.Rule] = struct{}{}
+		s.met.ValidationRejections.WithLabelValues(fe.Rule).Inc()
+	}
+}
+
+// GetOrders resolves as many ids as possible from the cache and loads the
+// rest from the database at once, caching them. It returns the found orders
+// in the order of ids and the ids that do not exist.
+func (s *Service) GetOrders(ctx context.Context, ids []string) ([]entity.Order, []string, error) {
+	found := make(map[string]*entity.Order, len(ids))
+	misses := make([]string, 0)
+	negHits := 0
+	for _, id := range ids {
+		if o, ok := s.cache.Get(id); ok {
+			found[id] = o
+			continue
+		}
+		if s.negative.Has(id) {
+			negHits++
+			continue
+		}
+		misses = append(misses, id)
+	}
+	if s.met != nil {
+		s.met.CacheHits.Add(float64(len(ids) - len(misses) - negHits))
+		s.met.CacheMisses.Add(float64(len(misses) + negHits))
+		if s.negative.Enabled() {
+			s.met.NegativeCacheHits.Add(float64(negHits))
+			s.met.NegativeCacheMisses.Add(float64(len(misses)))
+		}
+	}
+
+	if len(misses) > 0 {
+		gens := make(map[string]uint64, len(misses))
+		for _, id := range misses {
+			gens[id] = s.gens.Get(id)
+		}
+
+		start := time.Now()
+		loaded, err := s.repo.GetByIDs(ctx, misses)
+		if s.met != nil {
+			s.met.DBGetDuration.Observe(time.Since(start).Seconds())
+		}
+		if err != nil {
+			s.logger.Error("get orders from db failed", zap.Int("count", len(misses)), zap.Error(err))
+			return nil, nil, err
+		}
+		for i := range loaded {
+			o := &loaded[i]
+			s.cacheLoaded(o, gens[o.OrderUID])
+			found[o.OrderUID] = o
+		}
+		for _, id := range misses {
+			if _, ok := found[id]; !ok {
+				s.negative.Add(id, gens[id])
+			}
+		}
+	}
+
+	orders := make([]entity.Order, 0, len(found))
+	missing := make([]string, 0)
+	for _, id := range ids {
+		if o, ok := found[id]; ok {
+			orders = append(orders, *o)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return orders, missing, nil
+}
+
+func (s *Service) SearchOrders(ctx context.Context, f entity.OrderFilter) (*entity.OrderPage, error) {
+	page, err := s.repo.Search(ctx, f)
+	if err != nil {
+		s.logger.Error("search orders failed", zap.Error(err))
+		return nil, err
+	}
+	return page, nil
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/infrastructure"
+	oc "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/order-cache"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/pkg/config"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestDecodeOrderVersion(t *testing.T) {
+	s := &Service{logger: zap.NewNop()}
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		payload string
+		ev      entity.OrderEvent
+		want    int64
+		wantErr error
+	}{
+		{"explicit", `{"order_uid":"a","version":3}`, entity.OrderEvent{Timestamp: ts, Offset: 9}, 3, nil},
+		{"timestamp", `{"order_uid":"a"}`, entity.OrderEvent{Timestamp: ts, Offset: 9}, entity.BrokerVersionBase + ts.UnixMilli(), nil},
+		{"offset", `{"order_uid":"a"}`, entity.OrderEvent{Offset: 9}, entity.BrokerVersionBase + 9, nil},
+		{"negative", `{"order_uid":"a","version":-1}`, entity.OrderEvent{Timestamp: ts}, 0, ErrBadMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.ev.Payload = []byte(tt.payload)
+			o, err := s.decodeOrder(tt.ev)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && o.Version != tt.want {
+				t.Fatalf("version = %d, want %d", o.Version, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrokerVersionsRankBelowExplicitOnes(t *testing.T) {
+	s := &Service{logger: zap.NewNop()}
+
+	unversioned, err := s.decodeOrder(entity.OrderEvent{
+		Payload:   []byte(`{"order_uid":"a"}`),
+		Timestamp: time.Now(),
+		Offset:    1 << 40,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit, err := s.decodeOrder(entity.OrderEvent{Payload: []byte(`{"order_uid":"a","version":1}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unversioned.Version >= explicit.Version {
+		t.Fatalf("broker version %d does not rank below explicit version %d", unversioned.Version, explicit.Version)
+	}
+}
+
+func TestRebasedLegacyVersionsAcceptLaterMessages(t *testing.T) {
+	// migration 00012 moves versions stored before broker versions were
+	// rebased by the same base
+	migration, err := os.ReadFile("../../migrations/00012_rebase_broker_order_versions.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(migration), strconv.FormatInt(entity.BrokerVersionBase, 10)) {
+		t.Fatalf("migration 00012 does not rebase by %d", entity.BrokerVersionBase)
+	}
+
+	s := &Service{logger: zap.NewNop()}
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		stored int64
+		ev     entity.OrderEvent
+	}{
+		{"unversioned row, message with timestamp", 0, entity.OrderEvent{Payload: []byte(`{"order_uid":"a"}`), Timestamp: ts}},
+		{"unversioned row, message without timestamp", 0, entity.OrderEvent{Payload: []byte(`{"order_uid":"a"}`), Offset: 1}},
+		{"unversioned row, explicit version", 0, entity.OrderEvent{Payload: []byte(`{"order_uid":"a","version":1}`)}},
+		{"timestamp row, later message", ts.Add(-time.Hour).UnixMilli(), entity.OrderEvent{Payload: []byte(`{"order_uid":"a"}`), Timestamp: ts}},
+		{"timestamp row, explicit version", ts.UnixMilli(), entity.OrderEvent{Payload: []byte(`{"order_uid":"a","version":1}`)}},
+		{"offset row, explicit version", 42, entity.OrderEvent{Payload: []byte(`{"order_uid":"a","version":1}`)}},
+		{"offset row, message with timestamp", 42, entity.OrderEvent{Payload: []byte(`{"order_uid":"a"}`), Timestamp: ts, Offset: 43}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := s.decodeOrder(tt.ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the upsert only writes over versions lower than the new one
+			if rebased := tt.stored + entity.BrokerVersionBase; rebased >= o.Version {
+				t.Fatalf("stored version %d would reject new version %d", rebased, o.Version)
+			}
+		})
+	}
+}
+
+// batchRepo reports the orders listed in stale as older than the stored ones,
+// or fails the whole batch with err, and records the orders it was given.
+type batchRepo struct {
+	infrastructure.Repository
+	stale map[string]bool
+	err   error
+	saved []string
+}
+
+func (r *batchRepo) SaveBatch(_ context.Context, orders []*entity.Order, _ []entity.EventSource) ([]error, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	errs := make([]error, len(orders))
+	for i, o := range orders {
+		r.saved = append(r.saved, o.OrderUID)
+		if r.stale[o.OrderUID] {
+			errs[i] = infrastructure.ErrStaleVersion
+		}
+	}
+	return errs, nil
+}
+
+func TestSaveOrdersFromEvents(t *testing.T) {
+	payloads := []string{
+		`{"order_uid":"a","version":2}`,
+		`{"order_uid":"stale","version":1}`,
+		`{"order_uid":`,
+		`{"order_uid":"b","version":1}`,
+	}
+	dbDown := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		repoErr error
+		// want are the results per event; wantCached the orders cached after.
+		want       []error
+		wantErr    error
+		wantSaved  []string
+		wantCached []string
+	}{
+		{
+			name:       "valid, stale and bad messages",
+			want:       []error{nil, ErrStaleEvent, ErrBadMessage, nil},
+			wantSaved:  []string{"a", "stale", "b"},
+			wantCached: []string{"a", "b"},
+		},
+		{
+			name:    "failed batch",
+			repoErr: dbDown,
+			wantErr: dbDown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &batchRepo{stale: map[string]bool{"stale": true}, err: tt.repoErr}
+			cfg := config.CacheConfig{Limit: 10, NegativeTTL: time.Minute}
+			s := New(repo, oc.New(cfg, nil), zap.NewNop(), cfg, nil, nil, nil)
+
+			evs := make([]entity.OrderEvent, len(payloads))
+			for i, p := range payloads {
+				evs[i] = entity.OrderEvent{Payload: []byte(p), Offset: int64(i)}
+			}
+			errs, err := s.SaveOrdersFromEvents(context.Background(), evs)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if len(errs) != len(tt.want) {
+				t.Fatalf("got %d results, want %d", len(errs), len(tt.want))
+			}
+			for i := range errs {
+				if !errors.Is(errs[i], tt.want[i]) {
+					t.Fatalf("result %d = %v, want %v", i, errs[i], tt.want[i])
+				}
+			}
+			if strings.Join(repo.saved, ",") != strings.Join(tt.wantSaved, ",") {
+				t.Fatalf("saved %v, want %v", repo.saved, tt.wantSaved)
+			}
+			for _, id := range []string{"a", "stale", "b"} {
+				_, cached := s.cache.Get(id)
+				want := false
+				for _, c := range tt.wantCached {
+					want = want || c == id
+				}
+				if cached != want {
+					t.Fatalf("%s cached = %v, want %v", id, cached, want)
+				}
+			}
+		})
+	}
+}
+
+// blockingRepo returns order, or ErrOrderNotFound if missing is set, from
+// GetByID once release is closed, after signalling on reading.
+type blockingRepo struct {
+	infrastructure.Repository
+	order   entity.Order
+	missing bool
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRepo) GetByID(context.Context, string) (*entity.Order, error) {
+	close(r.reading)
+	<-r.release
+	if r.missing {
+		return nil, infrastructure.ErrOrderNotFound
+	}
+	o := r.order
+	return &o, nil
+}
+
+func TestLoadOrderDoesNotCacheOrdersChangedMeanwhile(t *testing.T) {
+	invalidate := func(s *Service) { s.InvalidateOrder(entity.OrderChange{OrderUID: "a", Version: 2}) }
+	evict := func(s *Service) { s.EvictOrder("a") }
+	flush := func(s *Service) { s.FlushCache() }
+
+	tests := []struct {
+		name    string
+		missing bool
+		change  func(s *Service)
+		// wantCached is whether the order, or its absence if missing, is
+		// cached after the load.
+		wantCached bool
+	}{
+		{"no change", false, func(*Service) {}, true},
+		{"invalidated", false, invalidate, false},
+		{"evicted", false, evict, false},
+		{"flushed", false, flush, false},
+		{"missing, no change", true, func(*Service) {}, true},
+		{"missing, invalidated", true, invalidate, false},
+		{"missing, evicted", true, evict, false},
+		{"missing, flushed", true, flush, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &blockingRepo{
+				order:   entity.Order{OrderUID: "a", Version: 1},
+				missing: tt.missing,
+				reading: make(chan struct{}),
+				release: make(chan struct{}),
+			}
+			cfg := config.CacheConfig{Limit: 10, NegativeTTL: time.Minute}
+			s := New(repo, oc.New(cfg, nil), zap.NewNop(), cfg, nil, nil, nil)
+
+			done := make(chan error)
+			go func() {
+				_, err := s.loadOrder(context.Background(), "a")
+				done <- err
+			}()
+
+			<-repo.reading
+			tt.change(s)
+			close(repo.release)
+			if err := <-done; err != nil && !errors.Is(err, infrastructure.ErrOrderNotFound) {
+				t.Fatal(err)
+			}
+
+			cached := s.negative.Has("a")
+			if !tt.missing {
+				_, cached = s.cache.Get("a")
+			}
+			if cached != tt.wantCached {
+				t.Fatalf("cached = %v, want %v", cached, tt.wantCached)
+			}
+		})
+	}
+}
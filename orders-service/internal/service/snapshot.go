@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	oc "github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/order-cache"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LoadCache fills the cache at startup: from the snapshot when one is
+// configured and readable, by a database warmup otherwise.
+func (s *Service) LoadCache(ctx context.Context) error {
+	if s.snapshotPath != "" {
+		err := s.RestoreCacheSnapshot(ctx)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			s.logger.Info("no cache snapshot, warming up from database", zap.String("path", s.snapshotPath))
+		} else {
+			s.logger.Warn("cannot restore cache snapshot, warming up from database",
+				zap.String("path", s.snapshotPath),
+				zap.Error(err),
+			)
+		}
+	}
+	return s.WarmupCache(ctx)
+}
+
+// SaveCacheSnapshot writes the cached orders to the snapshot file.
+func (s *Service) SaveCacheSnapshot() error {
+	if s.snapshotPath == "" {
+		return nil
+	}
+
+	orders := s.cache.Orders()
+	if err := oc.WriteSnapshot(context.Background(), s.snapshotPath, orders, s.enc); err != nil {
+		s.logger.Error("cache snapshot failed", zap.String("path", s.snapshotPath), zap.Error(err))
+		return err
+	}
+	s.logger.Info("cache snapshot saved", zap.String("path", s.snapshotPath), zap.Int("count", len(orders)))
+	return nil
+}
+
+// RestoreCacheSnapshot fills the cache from the snapshot file. Orders whose
+// updated_at in the database differs from the snapshot are reloaded, and
+// orders that no longer exist are dropped.
+func (s *Service) RestoreCacheSnapshot(ctx context.Context) error {
+	start := time.Now()
+
+	orders, err := oc.ReadSnapshot(ctx, s.snapshotPath, s.enc)
+	if err != nil {
+		return err
+	}
+
+	restored := make([]entity.Order, 0, len(orders))
+	reloaded := 0
+	for chunk := range slices.Chunk(orders, s.cacheWarmupChunk) {
+		ids := make([]string, len(chunk))
+		for i, o := range chunk {
+			ids[i] = o.OrderUID
+		}
+		updated, err := s.repo.UpdatedAt(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		var stale []string
+		for _, o := range chunk {
+			at, ok := updated[o.OrderUID]
+			switch {
+			case !ok:
+			case o.UpdatedAt.IsZero() || !at.Equal(o.UpdatedAt):
+				stale = append(stale, o.OrderUID)
+			default:
+				restored = append(restored, o)
+			}
+		}
+		if len(stale) == 0 {
+			continue
+		}
+
+		fresh, err := s.repo.GetByIDs(ctx, stale)
+		if err != nil {
+			return err
+		}
+		restored = append(restored, fresh...)
+		reloaded += len(fresh)
+	}
+
+	// least recently updated first, so that they are the first to go
+	sort.Slice(restored, func(i, j int) bool {
+		return restored[i].UpdatedAt.Before(restored[j].UpdatedAt)
+	})
+	for i := range restored {
+		o := restored[i]
+		s.cache.Set(o.OrderUID, &o)
+	}
+
+	if s.met != nil {
+		s.met.CacheWarmupLoaded.Set(float64(len(restored)))
+		s.met.CacheWarmupDuration.Set(time.Since(start).Seconds())
+	}
+	s.logger.Info("cache restored from snapshot",
+		zap.String("path", s.snapshotPath),
+		zap.Int("count", len(restored)),
+		zap.Int("reloaded", reloaded),
+		zap.Int("dropped", len(orders)-len(restored)),
+		zap.Duration("took", time.Since(start)),
+	)
+	return nil
+}
@@ -0,0 +1,144 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+)
+
+var DefaultCurrencies = []string{"RUB", "USD", "EUR", "KZT", "BYN", "KGS", "AMD", "UZS", "CNY"}
+
+var phoneRe = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// RequiredFields checks that identifying, delivery and payment fields are set
+// and that the order has items.
+func RequiredFields() Rule {
+	return NewRule("required", func(o *entity.Order) []FieldError {
+		var errs []FieldError
+		required := func(field, value string) {
+			if strings.TrimSpace(value) == "" {
+				errs = append(errs, FieldError{Field: field, Message: "is required"})
+			}
+		}
+
+		required("order_uid", o.OrderUID)
+		required("track_number", o.TrackNumber)
+		required("entry", o.Entry)
+		required("customer_id", o.CustomerID)
+		required("delivery.name", o.Delivery.Name)
+		required("delivery.phone", o.Delivery.Phone)
+		required("delivery.address", o.Delivery.Address)
+		required("payment.transaction", o.Payment.Transaction)
+		required("payment.currency", o.Payment.Currency)
+
+		if len(o.Items) == 0 {
+			errs = append(errs, FieldError{Field: "items", Message: "must not be empty"})
+		}
+		return errs
+	})
+}
+
+// Ranges checks that money amounts are not negative and sales are percents.
+func Ranges() Rule {
+	return NewRule("range", func(o *entity.Order) []FieldError {
+		var errs []FieldError
+		nonNegative := func(field string, value int) {
+			if value < 0 {
+				errs = append(errs, FieldError{Field: field, Message: "must not be negative"})
+			}
+		}
+
+		nonNegative("payment.amount", o.Payment.Amount)
+		nonNegative("payment.delivery_cost", o.Payment.DeliveryCost)
+		nonNegative("payment.goods_total", o.Payment.GoodsTotal)
+		nonNegative("payment.custom_fee", o.Payment.CustomFee)
+
+		for i, it := range o.Items {
+			nonNegative(fmt.Sprintf("items[%d].price", i), it.Price)
+			nonNegative(fmt.Sprintf("items[%d].total_price", i), it.TotalPrice)
+			if it.Sale < 0 || it.Sale > 100 {
+				errs = append(errs, FieldError{
+					Field:   fmt.Sprintf("items[%d].sale", i),
+					Message: "must be between 0 and 100",
+				})
+			}
+		}
+		return errs
+	})
+}
+
+// Items checks that every item has a chrt_id and that it is unique within the
+// order, since items are stored and reconciled by it.
+func Items() Rule {
+	return NewRule("items", func(o *entity.Order) []FieldError {
+		var errs []FieldError
+		seen := make(map[int64]struct{}, len(o.Items))
+		for i, it := range o.Items {
+			field := fmt.Sprintf("items[%d].chrt_id", i)
+			if it.ChrtID == 0 {
+				errs = append(errs, FieldError{Field: field, Message: "is required"})
+				continue
+			}
+			if _, ok := seen[it.ChrtID]; ok {
+				errs = append(errs, FieldError{Field: field, Message: "is duplicated"})
+				continue
+			}
+			seen[it.ChrtID] = struct{}{}
+		}
+		return errs
+	})
+}
+
+// GoodsTotal checks that payment.goods_total matches the sum of item totals.
+func GoodsTotal() Rule {
+	return NewRule("goods_total", func(o *entity.Order) []FieldError {
+		sum := 0
+		for _, it := range o.Items {
+			sum += it.TotalPrice
+		}
+		if sum != o.Payment.GoodsTotal {
+			return []FieldError{{
+				Field:   "payment.goods_total",
+				Message: fmt.Sprintf("is %d, but items total to %d", o.Payment.GoodsTotal, sum),
+			}}
+		}
+		return nil
+	})
+}
+
+// Contacts checks the format of delivery phone and email when they are set.
+func Contacts() Rule {
+	return NewRule("contacts", func(o *entity.Order) []FieldError {
+		var errs []FieldError
+		if o.Delivery.Phone != "" && !phoneRe.MatchString(o.Delivery.Phone) {
+			errs = append(errs, FieldError{Field: "delivery.phone", Message: "is not a valid phone number"})
+		}
+		if o.Delivery.Email != "" {
+			if a, err := mail.ParseAddress(o.Delivery.Email); err != nil || a.Address != o.Delivery.Email {
+				errs = append(errs, FieldError{Field: "delivery.email", Message: "is not a valid email"})
+			}
+		}
+		return errs
+	})
+}
+
+// Currency checks that payment.currency is one of allowed, ignoring case.
+func Currency(allowed ...string) Rule {
+	known := make(map[string]struct{}, len(allowed))
+	for _, c := range allowed {
+		known[strings.ToUpper(c)] = struct{}{}
+	}
+
+	return NewRule("currency", func(o *entity.Order) []FieldError {
+		if o.Payment.Currency == "" {
+			return nil
+		}
+		if _, ok := known[strings.ToUpper(o.Payment.Currency)]; !ok {
+			return []FieldError{{Field: "payment.currency", Message: "is not a known currency"}}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,164 @@
+package validation
+
+import (
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// validOrder returns an order that passes the default rules.
+func validOrder() *entity.Order {
+	return &entity.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		CustomerID:  "test",
+		Delivery: entity.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Address: "Ploshad Mira 15",
+			Email:   "test@gmail.com",
+		},
+		Payment: entity.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Amount:       1817,
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []entity.Item{
+			{ChrtID: 9934930, Price: 453, Sale: 30, TotalPrice: 317},
+		},
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(o *entity.Order)
+		// want are the rule and field of each expected violation.
+		want []string
+	}{
+		{"valid", func(*entity.Order) {}, nil},
+		{
+			name: "required fields",
+			change: func(o *entity.Order) {
+				o.TrackNumber, o.Delivery.Name, o.Payment.Transaction = "", " ", ""
+			},
+			want: []string{"required delivery.name", "required payment.transaction", "required track_number"},
+		},
+		{
+			name: "no items",
+			change: func(o *entity.Order) {
+				o.Items, o.Payment.GoodsTotal = nil, 0
+			},
+			want: []string{"required items"},
+		},
+		{
+			name: "negative amounts",
+			change: func(o *entity.Order) {
+				o.Payment.Amount, o.Payment.CustomFee = -1, -5
+			},
+			want: []string{"range payment.amount", "range payment.custom_fee"},
+		},
+		{
+			name: "negative item price and sale over 100",
+			change: func(o *entity.Order) {
+				o.Items[0].Price, o.Items[0].Sale = -453, 101
+			},
+			want: []string{"range items[0].price", "range items[0].sale"},
+		},
+		{
+			name: "negative item total",
+			change: func(o *entity.Order) {
+				o.Items[0].TotalPrice, o.Payment.GoodsTotal = -1, -1
+			},
+			want: []string{"range items[0].total_price", "range payment.goods_total"},
+		},
+		{
+			name: "goods total does not match items",
+			change: func(o *entity.Order) {
+				o.Items = append(o.Items, entity.Item{ChrtID: 1, Price: 100, TotalPrice: 100})
+			},
+			want: []string{"goods_total payment.goods_total"},
+		},
+		{
+			name: "goods total matches several items",
+			change: func(o *entity.Order) {
+				o.Items = append(o.Items, entity.Item{ChrtID: 1, Price: 100, TotalPrice: 100})
+				o.Payment.GoodsTotal = 417
+			},
+		},
+		{
+			name: "missing and duplicated chrt_id",
+			change: func(o *entity.Order) {
+				o.Items = append(o.Items, entity.Item{}, entity.Item{ChrtID: 9934930})
+			},
+			want: []string{"items items[1].chrt_id", "items items[2].chrt_id"},
+		},
+		{
+			name: "malformed contacts",
+			change: func(o *entity.Order) {
+				o.Delivery.Phone, o.Delivery.Email = "12-34", "Test <test@gmail.com>"
+			},
+			want: []string{"contacts delivery.email", "contacts delivery.phone"},
+		},
+		{
+			name: "unknown currency",
+			change: func(o *entity.Order) {
+				o.Payment.Currency = "XXX"
+			},
+			want: []string{"currency payment.currency"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := validOrder()
+			tt.change(o)
+
+			var got []string
+			err := Default().Validate(o)
+			if err != nil {
+				errs, ok := err.(Errors)
+				if !ok {
+					t.Fatalf("error = %T, want Errors", err)
+				}
+				for _, fe := range errs {
+					got = append(got, fe.Rule+" "+fe.Field)
+				}
+				sort.Strings(got)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	rule := Currency("usd", "RUB")
+
+	tests := []struct {
+		currency string
+		valid    bool
+	}{
+		{"USD", true},
+		{"usd", true},
+		{"rub", true},
+		{"RUB", true},
+		{"", true},
+		{"EUR", false},
+		{"US", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			o := &entity.Order{Payment: entity.Payment{Currency: tt.currency}}
+			if errs := rule.Validate(o); (len(errs) == 0) != tt.valid {
+				t.Fatalf("Validate(%q) = %v, want valid %v", tt.currency, errs, tt.valid)
+			}
+		})
+	}
+}
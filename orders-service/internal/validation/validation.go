@@ -0,0 +1,88 @@
+package validation
+
+import (
+	"strings"
+
+	"github.com/dunooo0ooo/wb-tech-l0/orders-service/internal/entity"
+)
+
+// FieldError describes one rule violation on one field of an order.
+type FieldError struct {
+	Rule    string `json:"rule"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Errors is the list of violations found in an order.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Rule checks one aspect of an order.
+type Rule interface {
+	Name() string
+	Validate(o *entity.Order) []FieldError
+}
+
+type ruleFunc struct {
+	name string
+	fn   func(o *entity.Order) []FieldError
+}
+
+func (r ruleFunc) Name() string { return r.name }
+
+func (r ruleFunc) Validate(o *entity.Order) []FieldError { return r.fn(o) }
+
+// NewRule builds a Rule from a function.
+func NewRule(name string, fn func(o *entity.Order) []FieldError) Rule {
+	return ruleFunc{name: name, fn: fn}
+}
+
+type Validator struct {
+	rules []Rule
+}
+
+func New(rules ...Rule) *Validator {
+	return &Validator{rules: rules}
+}
+
+// Default returns a validator with the rules every incoming order must pass.
+// DefaultCurrencies are accepted when currencies is empty.
+func Default(currencies ...string) *Validator {
+	if len(currencies) == 0 {
+		currencies = DefaultCurrencies
+	}
+	return New(
+		RequiredFields(),
+		Ranges(),
+		Items(),
+		GoodsTotal(),
+		Contacts(),
+		Currency(currencies...),
+	)
+}
+
+// Validate runs all rules and returns Errors if any of them failed.
+func (v *Validator) Validate(o *entity.Order) error {
+	var errs Errors
+	for _, r := range v.rules {
+		for _, fe := range r.Validate(o) {
+			fe.Rule = r.Name()
+			errs = append(errs, fe)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS order_revisions
+(
+    id              BIGSERIAL PRIMARY KEY,
+    order_uid       text        NOT NULL REFERENCES orders (order_uid) ON DELETE CASCADE,
+    version         bigint      NOT NULL,
+    snapshot        jsonb       NOT NULL,
+    kafka_topic     text,
+    kafka_partition integer,
+    kafka_offset    bigint,
+    received_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_revisions_order_uid ON order_revisions (order_uid, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_order_revisions_order_uid;
+DROP TABLE IF EXISTS order_revisions;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_order_changed() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify(
+        'orders_changed',
+        json_build_object('order_uid', NEW.order_uid, 'version', NEW.version)::text
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER orders_changed
+    AFTER INSERT OR UPDATE ON orders
+    FOR EACH ROW EXECUTE FUNCTION notify_order_changed();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS orders_changed ON orders;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS notify_order_changed();
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE session_rotated_tokens
+(
+    session_id text        NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    token_hash bytea       NOT NULL,
+    rotated_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (session_id, token_hash)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS session_rotated_tokens;
+-- +goose StatementEnd
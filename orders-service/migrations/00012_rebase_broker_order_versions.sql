@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Versions taken from the broker used to be plain Kafka timestamps in
+-- milliseconds, or offsets for messages without a timestamp, and outranked
+-- explicit versions. Orders stored before versioning have version 0. Move
+-- all of them below every explicit version, where the service now puts
+-- unversioned messages, so that later unversioned messages still update
+-- them:
+--   - version 0: stored before versioning;
+--   - version >= 10^12: a timestamp, explicit versions are assumed to stay
+--     below it;
+--   - a version equal to the Kafka offset of the revision that wrote it: an
+--     offset.
+UPDATE order_revisions r
+SET version = r.version + (-4611686018427387904)
+WHERE r.version >= 1000000000000
+   OR r.version = r.kafka_offset;
+
+UPDATE orders o
+SET version = o.version + (-4611686018427387904)
+WHERE o.version = 0
+   OR o.version >= 1000000000000
+   OR EXISTS (SELECT 1
+              FROM order_revisions r
+              WHERE r.order_uid = o.order_uid
+                AND r.version = o.version + (-4611686018427387904)
+                AND r.kafka_offset = o.version);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE orders
+SET version = version - (-4611686018427387904)
+WHERE version < 0;
+
+UPDATE order_revisions
+SET version = version - (-4611686018427387904)
+WHERE version < 0;
+-- +goose StatementEnd
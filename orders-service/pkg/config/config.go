@@ -4,12 +4,21 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type HTTPConfig struct {
 	Addr string
 }
 
+type AuthConfig struct {
+	Enabled bool
+	// JWKSURL is where user-service publishes its token keys.
+	JWKSURL      string
+	Issuer       string
+	MetricsToken string
+}
+
 type PostgresConfig struct {
 	Host          string
 	Port          int
@@ -24,21 +33,53 @@ type LoggerConfig struct {
 }
 
 type KafkaConsumerConfig struct {
-	Brokers []string
-	Topic   string
-	GroupID string
+	Brokers      []string
+	Topic        string
+	GroupID      string
+	DLQTopic     string
+	ParkingTopic string
+	MaxAttempts  int
+	Workers      int
+	BatchSize    int
+	BatchTimeout time.Duration
 }
 
 type Config struct {
 	HTTP     HTTPConfig
+	Auth     AuthConfig
 	Postgres PostgresConfig
 	Logger   LoggerConfig
 	Kafka    KafkaConsumerConfig
 	Cache    CacheConfig
+
+	Validation ValidationConfig
+	Privacy    PrivacyConfig
 }
 
 type CacheConfig struct {
-	Limit int
+	Limit       int
+	WarmupChunk int
+	WarmupAsync bool
+	NegativeTTL time.Duration
+	TTL         time.Duration
+	MaxBytes    int
+	Shards      int
+	Policy      string
+	Invalidate  bool
+	Snapshot    string
+}
+
+type PrivacyConfig struct {
+	// PIIPolicy overrides the default projection of PII fields, e.g.
+	// "delivery.city=mask,payment.bank=show".
+	PIIPolicy string
+	// KeyFile holds the master keys PII columns and cache snapshots are
+	// encrypted with at rest; without it they are stored in plaintext.
+	KeyFile string
+}
+
+type ValidationConfig struct {
+	Currencies []string
 }
 
 func getenv(key, def string) string {
@@ -58,11 +99,37 @@ func getenvInt(key string, def int) int {
 	return def
 }
 
+func getenvBool(key string, def bool) bool {
+	if v := os.Getenv(key); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+func getenvList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 func Load() Config {
 	return Config{
 		HTTP: HTTPConfig{
 			Addr: getenv("HTTP_ADDR", ":8081"),
 		},
+		Auth: AuthConfig{
+			Enabled:      getenvBool("AUTH_ENABLED", true),
+			JWKSURL:      getenv("AUTH_JWKS_URL", "http://localhost:8082/.well-known/jwks.json"),
+			Issuer:       getenv("AUTH_ISSUER", "user-service"),
+			MetricsToken: getenv("AUTH_METRICS_TOKEN", ""),
+		},
 		Postgres: PostgresConfig{
 			Host:          getenv("POSTGRES_HOST", "localhost"),
 			Port:          getenvInt("POSTGRES_PORT", 5432),
@@ -75,12 +142,34 @@ func Load() Config {
 			Level: getenv("LOG_LEVEL", "info"),
 		},
 		Kafka: KafkaConsumerConfig{
-			Brokers: strings.Split(getenv("KAFKA_BROKERS", "localhost:29092"), ","),
-			Topic:   getenv("KAFKA_TOPIC", "orders"),
-			GroupID: getenv("KAFKA_GROUP_ID", "order-information-service"),
+			Brokers:      strings.Split(getenv("KAFKA_BROKERS", "localhost:29092"), ","),
+			Topic:        getenv("KAFKA_TOPIC", "orders"),
+			GroupID:      getenv("KAFKA_GROUP_ID", "order-information-service"),
+			DLQTopic:     getenv("KAFKA_DLQ_TOPIC", "orders-dlq"),
+			ParkingTopic: getenv("KAFKA_PARKING_TOPIC", "orders-parked"),
+			MaxAttempts:  getenvInt("KAFKA_MAX_ATTEMPTS", 5),
+			Workers:      getenvInt("KAFKA_WORKERS", 4),
+			BatchSize:    getenvInt("KAFKA_BATCH_SIZE", 1),
+			BatchTimeout: time.Duration(getenvInt("KAFKA_BATCH_TIMEOUT_MS", 100)) * time.Millisecond,
 		},
 		Cache: CacheConfig{
-			Limit: getenvInt("CACHE_LIMIT", 500),
+			Limit:       getenvInt("CACHE_LIMIT", 500),
+			WarmupChunk: getenvInt("CACHE_WARMUP_CHUNK", 1000),
+			WarmupAsync: getenvBool("CACHE_WARMUP_ASYNC", false),
+			NegativeTTL: time.Duration(getenvInt("CACHE_NEGATIVE_TTL_MS", 5000)) * time.Millisecond,
+			TTL:         time.Duration(getenvInt("CACHE_TTL_MS", 0)) * time.Millisecond,
+			MaxBytes:    getenvInt("CACHE_MAX_BYTES", 0),
+			Shards:      getenvInt("CACHE_SHARDS", 1),
+			Policy:      getenv("CACHE_POLICY", "lru"),
+			Invalidate:  getenvBool("CACHE_INVALIDATE", true),
+			Snapshot:    getenv("CACHE_SNAPSHOT_PATH", ""),
+		},
+		Validation: ValidationConfig{
+			Currencies: getenvList("VALIDATION_CURRENCIES"),
+		},
+		Privacy: PrivacyConfig{
+			PIIPolicy: getenv("PII_POLICY", ""),
+			KeyFile:   getenv("PII_KEY_FILE", ""),
 		},
 	}
 }
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/app"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/delivery"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure/postgres"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/service"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/token"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/pkg/config"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/pkg/logger"
 
@@ -53,8 +57,28 @@ func main() {
 		zap.String("db", cfg.Postgres.DBName),
 	)
 
+	var keys *token.KeySet
+	if cfg.JWT.KeysDir != "" {
+		keys, err = token.LoadKeys(cfg.JWT.KeysDir, cfg.JWT.SigningKID)
+	} else {
+		log.Warn("JWT_KEYS_DIR is not set, signing tokens with an ephemeral key")
+		keys, err = token.GenerateKeys()
+	}
+	if err != nil {
+		log.Fatal("cannot load signing keys", zap.Error(err))
+	}
+	log.Info("signing keys loaded", zap.String("signing_kid", keys.Signing().ID))
+
 	repository := postgres.NewUserRepository(dbpool)
-	svc := service.NewUserService(repository, log)
+	issuer := token.NewIssuer(keys, cfg.JWT.Issuer, cfg.JWT.AccessTTL)
+	svc := service.NewUserService(repository, repository, log, issuer, cfg.JWT.RefreshTTL)
+
+	if cfg.Admin.Username != "" {
+		_, err := svc.TryCreate(ctx, cfg.Admin.Username, cfg.Admin.Password, entity.UserRoleAdmin)
+		if err != nil && !errors.Is(err, infrastructure.ErrUserAlreadyExist) {
+			log.Fatal("cannot create admin", zap.String("username", cfg.Admin.Username), zap.Error(err))
+		}
+	}
 
 	handler := delivery.New(svc)
 	mux := http.NewServeMux()
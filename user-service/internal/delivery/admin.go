@@ -0,0 +1,92 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/delivery/dto"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/service"
+	"net/http"
+	"strings"
+)
+
+// AdminCreateUser creates a user with the requested role, the user role by
+// default. Only admins may call it.
+func (h *UserHandler) AdminCreateUser(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var req dto.AdminCreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	role, ok := parseRole(w, req.Role)
+	if !ok {
+		return
+	}
+	h.createUser(w, r, req.Username, req.Password, role)
+}
+
+// SetRole changes the role of a user. Only admins may call it.
+func (h *UserHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var req dto.SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	role, ok := parseRole(w, req.Role)
+	if !ok {
+		return
+	}
+
+	err := h.us.SetRole(r.Context(), r.PathValue("username"), role)
+	if err != nil {
+		switch {
+		case errors.Is(err, infrastructure.ErrUserNotFound):
+			http.Error(w, "user not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidArguments):
+			http.Error(w, "invalid arguments", http.StatusBadRequest)
+		default:
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireAdmin writes a 401 or 403 response unless r carries the access
+// token of an admin.
+func (h *UserHandler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	claims, ok := h.authenticate(w, r)
+	if !ok {
+		return false
+	}
+	if entity.UserRole(claims.Role) != entity.UserRoleAdmin {
+		http.Error(w, "admin role required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// parseRole returns the role named s, the user role if s is empty, and
+// writes a 400 response for unknown roles.
+func parseRole(w http.ResponseWriter, s string) (entity.UserRole, bool) {
+	role := entity.UserRole(strings.TrimSpace(s))
+	if role == "" {
+		return entity.UserRoleUser, true
+	}
+	if !role.Valid() {
+		http.Error(w, "unknown role", http.StatusBadRequest)
+		return "", false
+	}
+	return role, true
+}
@@ -1,20 +1,52 @@
 package dto
 
+import "time"
+
 type CreateUserRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+}
+
+// AdminCreateUserRequest creates a user with any role.
+type AdminCreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 	Role     string `json:"role"`
 }
 
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
 type CreateUserResponse struct {
 	IsSuccess bool `json:"isSuccess"`
 }
 
-type VerifyUserRequest struct {
+type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 }
 
-type VerifyUserResponse struct {
-	Role string `json:"role"`
+type LoginResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"`
+	SessionID        string `json:"session_id"`
+	Role             string `json:"role"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
 }
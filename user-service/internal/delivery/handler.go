@@ -8,13 +8,23 @@ import (
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/entity"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/service"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/token"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type UserService interface {
-	TryCreate(ctx context.Context, username, password, role string) (bool, error)
+	TryCreate(ctx context.Context, username, password string, role entity.UserRole) (bool, error)
+	SetRole(ctx context.Context, username string, role entity.UserRole) error
 	VerifyUser(ctx context.Context, username, password string) (entity.User, error)
+	Login(ctx context.Context, username, password, device string) (service.Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (service.Tokens, error)
+	Logout(ctx context.Context, refreshToken string) error
+	Sessions(ctx context.Context, username string) ([]entity.Session, error)
+	RevokeSession(ctx context.Context, username, id string) error
+	Authenticate(accessToken string) (*token.Claims, error)
+	JWKS() token.JWKS
 }
 
 type UserHandler struct {
@@ -29,9 +39,18 @@ func New(us UserService) *UserHandler {
 
 func (h *UserHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /users", h.CreateUser)
-	mux.HandleFunc("GET /login", h.Verify)
+	mux.HandleFunc("POST /login", h.Login)
+	mux.HandleFunc("POST /token/refresh", h.Refresh)
+	mux.HandleFunc("POST /logout", h.Logout)
+	mux.HandleFunc("GET /sessions", h.ListSessions)
+	mux.HandleFunc("DELETE /sessions/{id}", h.DeleteSession)
+	mux.HandleFunc("GET /.well-known/jwks.json", h.JWKS)
+	mux.HandleFunc("POST /admin/users", h.AdminCreateUser)
+	mux.HandleFunc("PUT /admin/users/{username}/role", h.SetRole)
 }
 
+// CreateUser signs up a user. Anybody may sign up, so the user always gets
+// the user role; other roles are granted by admins.
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var req dto.CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -39,18 +58,17 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.Username = strings.TrimSpace(req.Username)
-	req.Role = strings.TrimSpace(req.Role)
+	h.createUser(w, r, req.Username, req.Password, entity.UserRoleUser)
+}
 
-	if req.Role == "" {
-		req.Role = "user"
-	}
-	if req.Username == "" || req.Password == "" {
+func (h *UserHandler) createUser(w http.ResponseWriter, r *http.Request, username, password string, role entity.UserRole) {
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
 		http.Error(w, "username and password are required", http.StatusBadRequest)
 		return
 	}
 
-	ok, err := h.us.TryCreate(r.Context(), req.Username, req.Password, req.Role)
+	ok, err := h.us.TryCreate(r.Context(), username, password, role)
 	if err != nil {
 		if errors.Is(err, infrastructure.ErrUserAlreadyExist) {
 			http.Error(w, "user already exist", http.StatusConflict)
@@ -67,8 +85,9 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *UserHandler) Verify(w http.ResponseWriter, r *http.Request) {
-	var req dto.VerifyUserRequest
+// Login exchanges a username and password for a signed access token.
+func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req dto.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
@@ -80,18 +99,39 @@ func (h *UserHandler) Verify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := h.us.VerifyUser(r.Context(), req.Username, req.Password)
+	t, err := h.us.Login(r.Context(), req.Username, req.Password, req.Device)
 	if err != nil {
-		if errors.Is(err, service.ErrInvalidArguments) {
+		switch {
+		case errors.Is(err, service.ErrInvalidArguments):
 			http.Error(w, "invalid arguments", http.StatusBadRequest)
-			return
+		case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, infrastructure.ErrUserNotFound):
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		default:
+			http.Error(w, "internal error", http.StatusInternalServerError)
 		}
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
+	writeTokens(w, t)
+}
+
+func writeTokens(w http.ResponseWriter, t service.Tokens) {
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(dto.VerifyUserResponse{
-		Role: string(u.Role),
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(dto.LoginResponse{
+		AccessToken:      t.AccessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(time.Until(t.ExpiresAt).Seconds()),
+		RefreshToken:     t.RefreshToken,
+		RefreshExpiresIn: int(time.Until(t.RefreshExpiresAt).Seconds()),
+		SessionID:        t.SessionID,
+		Role:             string(t.Role),
 	})
 }
+
+// JWKS publishes the public keys of all tokens that are still accepted.
+func (h *UserHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(h.us.JWKS())
+}
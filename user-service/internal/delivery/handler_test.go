@@ -0,0 +1,222 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/delivery/dto"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/service"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/token"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type memUsers struct {
+	mu    sync.Mutex
+	users map[string]entity.User
+}
+
+func (m *memUsers) TryCreate(_ context.Context, u *entity.User) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[u.Username]; ok {
+		return false, infrastructure.ErrUserAlreadyExist
+	}
+	u.ID = int64(len(m.users) + 1)
+	m.users[u.Username] = *u
+	return true, nil
+}
+
+func (m *memUsers) GetUserByUsername(_ context.Context, username string) (entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return entity.User{}, infrastructure.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (m *memUsers) SetRole(_ context.Context, username string, role entity.UserRole) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return infrastructure.ErrUserNotFound
+	}
+	u.Role = role
+	m.users[username] = u
+	return nil
+}
+
+// memSessions only opens sessions, which is all logging in needs.
+type memSessions struct {
+	infrastructure.SessionRepository
+}
+
+func (memSessions) CreateSession(context.Context, *entity.Session) error {
+	return nil
+}
+
+func newTestHandler(t *testing.T) (http.Handler, *service.UserService) {
+	t.Helper()
+
+	keys, err := token.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &memUsers{users: map[string]entity.User{}}
+	svc := service.NewUserService(users, memSessions{}, zap.NewNop(), token.NewIssuer(keys, "user-service", time.Minute), time.Hour)
+
+	mux := http.NewServeMux()
+	New(svc).RegisterRoutes(mux)
+	return mux, svc
+}
+
+func do(t *testing.T, h http.Handler, method, path, accessToken string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// login returns the access token of username and the role signed into it.
+func login(t *testing.T, h http.Handler, svc *service.UserService, username, password string) (string, string) {
+	t.Helper()
+	rec := do(t, h, http.MethodPost, "/login", "", dto.LoginRequest{Username: username, Password: password})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login %s: status %d: %s", username, rec.Code, rec.Body)
+	}
+	var resp dto.LoginResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := svc.Authenticate(resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.AccessToken, claims.Role
+}
+
+func TestSelfSignupAlwaysGetsUserRole(t *testing.T) {
+	tests := []struct {
+		name string
+		body map[string]string
+	}{
+		{"no role", map[string]string{"username": "alice", "password": "secret"}},
+		{"user role", map[string]string{"username": "alice", "password": "secret", "role": "user"}},
+		{"admin role", map[string]string{"username": "alice", "password": "secret", "role": "admin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, svc := newTestHandler(t)
+
+			if rec := do(t, h, http.MethodPost, "/users", "", tt.body); rec.Code != http.StatusCreated {
+				t.Fatalf("signup: status %d: %s", rec.Code, rec.Body)
+			}
+			if _, role := login(t, h, svc, "alice", "secret"); role != string(entity.UserRoleUser) {
+				t.Fatalf("token role = %q, want %q", role, entity.UserRoleUser)
+			}
+		})
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	h, svc := newTestHandler(t)
+	ctx := context.Background()
+	for _, u := range []entity.User{{Username: "root", Role: entity.UserRoleAdmin}, {Username: "alice", Role: entity.UserRoleUser}} {
+		if _, err := svc.TryCreate(ctx, u.Username, "secret", u.Role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	adminToken, _ := login(t, h, svc, "root", "secret")
+	userToken, _ := login(t, h, svc, "alice", "secret")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       any
+		wantStatus int
+		// wantRole is the role username logs in with afterwards, if set.
+		username string
+		wantRole entity.UserRole
+	}{
+		{
+			name:   "create without token",
+			method: http.MethodPost, path: "/admin/users",
+			body:       dto.AdminCreateUserRequest{Username: "mallory", Password: "secret", Role: "admin"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "create as user",
+			method: http.MethodPost, path: "/admin/users", token: userToken,
+			body:       dto.AdminCreateUserRequest{Username: "mallory", Password: "secret", Role: "admin"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "create unknown role",
+			method: http.MethodPost, path: "/admin/users", token: adminToken,
+			body:       dto.AdminCreateUserRequest{Username: "bob", Password: "secret", Role: "root"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "create admin as admin",
+			method: http.MethodPost, path: "/admin/users", token: adminToken,
+			body:       dto.AdminCreateUserRequest{Username: "bob", Password: "secret", Role: "admin"},
+			wantStatus: http.StatusCreated,
+			username:   "bob", wantRole: entity.UserRoleAdmin,
+		},
+		{
+			name:   "promote as user",
+			method: http.MethodPut, path: "/admin/users/alice/role", token: userToken,
+			body:       dto.SetRoleRequest{Role: "admin"},
+			wantStatus: http.StatusForbidden,
+			username:   "alice", wantRole: entity.UserRoleUser,
+		},
+		{
+			name:   "promote unknown user",
+			method: http.MethodPut, path: "/admin/users/nobody/role", token: adminToken,
+			body:       dto.SetRoleRequest{Role: "admin"},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "promote as admin",
+			method: http.MethodPut, path: "/admin/users/alice/role", token: adminToken,
+			body:       dto.SetRoleRequest{Role: "admin"},
+			wantStatus: http.StatusNoContent,
+			username:   "alice", wantRole: entity.UserRoleAdmin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := do(t, h, tt.method, tt.path, tt.token, tt.body); rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.username == "" {
+				return
+			}
+			if _, role := login(t, h, svc, tt.username, "secret"); role != string(tt.wantRole) {
+				t.Fatalf("token role = %q, want %q", role, tt.wantRole)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/delivery/dto"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/service"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/token"
+	"net/http"
+	"strings"
+)
+
+// Refresh rotates a refresh token and issues a new access token.
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req dto.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.us.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		writeRefreshError(w, err)
+		return
+	}
+	writeTokens(w, t)
+}
+
+// Logout revokes the session of the given refresh token.
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req dto.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.us.Logout(r.Context(), req.RefreshToken); err != nil {
+		writeRefreshError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessions returns the active sessions of the authenticated user.
+func (h *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.us.Sessions(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]dto.SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, dto.SessionResponse{
+			ID:         s.ID,
+			Device:     s.Device,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == claims.SessionID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// DeleteSession revokes one session of the authenticated user.
+func (h *UserHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.us.RevokeSession(r.Context(), claims.Subject, r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, infrastructure.ErrSessionNotFound) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate returns the claims of the bearer access token of r and
+// writes a 401 response if there is no valid one.
+func (h *UserHandler) authenticate(w http.ResponseWriter, r *http.Request) (*token.Claims, bool) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "access token required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	claims, err := h.us.Authenticate(raw)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "invalid access token", http.StatusUnauthorized)
+		return nil, false
+	}
+	return claims, true
+}
+
+func writeRefreshError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRefreshToken), errors.Is(err, service.ErrRefreshTokenReused):
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+	default:
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// Session is a login of a user on one device, kept alive by refresh tokens.
+// Only hashes of refresh tokens are stored: the one of the current token here
+// and those of rotated out ones separately, to recognise reuse.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"-"`
+	Username   string     `json:"-"`
+	Role       UserRole   `json:"-"`
+	Device     string     `json:"device"`
+	TokenHash  []byte     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the session can still be refreshed at now.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
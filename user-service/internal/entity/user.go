@@ -1,6 +1,7 @@
 package entity
 
 type User struct {
+	ID       int64    `json:"id"`
 	Username string   `json:"username"`
 	Password string   `json:"password"`
 	Role     UserRole `json:"role"`
@@ -12,3 +13,8 @@ const (
 	UserRoleAdmin UserRole = "admin"
 	UserRoleUser  UserRole = "user"
 )
+
+// Valid reports whether r is one of the known roles.
+func (r UserRole) Valid() bool {
+	return r == UserRoleAdmin || r == UserRoleUser
+}
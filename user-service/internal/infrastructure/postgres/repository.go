@@ -50,14 +50,30 @@ func (repo *Repository) TryCreate(ctx context.Context, user *entity.User) (bool,
 	return true, nil
 }
 
+func (repo *Repository) SetRole(ctx context.Context, username string, role entity.UserRole) error {
+	tag, err := repo.pool.Exec(ctx, `
+		UPDATE users
+		SET role = @role
+		WHERE username = @username
+	`, pgx.NamedArgs{"username": username, "role": role})
+	if err != nil {
+		return infrastructure.ErrInternalDatabase
+	}
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrUserNotFound
+	}
+	return nil
+}
+
 func (repo *Repository) GetUserByUsername(ctx context.Context, username string) (entity.User, error) {
 	var u entity.User
 
 	err := repo.pool.QueryRow(ctx, `
-		SELECT username, password, role
+		SELECT id, username, password, role
 		FROM users
 		WHERE username = @username
 	`, pgx.NamedArgs{"username": username}).Scan(
+		&u.ID,
 		&u.Username,
 		&u.Password,
 		&u.Role,
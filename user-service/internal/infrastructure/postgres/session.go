@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+func (repo *Repository) CreateSession(ctx context.Context, s *entity.Session) error {
+	err := repo.pool.QueryRow(ctx, `
+		INSERT INTO sessions(id, user_id, device, token_hash, expires_at)
+		VALUES(@id, @user_id, @device, @token_hash, @expires_at)
+		RETURNING created_at, last_used_at
+	`, pgx.NamedArgs{
+		"id":         s.ID,
+		"user_id":    s.UserID,
+		"device":     s.Device,
+		"token_hash": s.TokenHash,
+		"expires_at": s.ExpiresAt,
+	}).Scan(&s.CreatedAt, &s.LastUsedAt)
+	if err != nil {
+		return infrastructure.ErrInternalDatabase
+	}
+	return nil
+}
+
+func (repo *Repository) GetSession(ctx context.Context, id string) (entity.Session, error) {
+	var s entity.Session
+
+	err := repo.pool.QueryRow(ctx, `
+		SELECT s.id, s.user_id, u.username, u.role, s.device, s.token_hash,
+		       s.created_at, s.last_used_at, s.expires_at, s.revoked_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = @id
+	`, pgx.NamedArgs{"id": id}).Scan(
+		&s.ID, &s.UserID, &s.Username, &s.Role, &s.Device, &s.TokenHash,
+		&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.Session{}, infrastructure.ErrSessionNotFound
+		}
+		return entity.Session{}, infrastructure.ErrInternalDatabase
+	}
+	return s, nil
+}
+
+func (repo *Repository) RotateSession(ctx context.Context, id string, oldHash, newHash []byte, expiresAt time.Time) error {
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return infrastructure.ErrInternalDatabase
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE sessions
+		SET token_hash = @new_hash, expires_at = @expires_at, last_used_at = now()
+		WHERE id = @id AND token_hash = @old_hash AND revoked_at IS NULL AND expires_at > now()
+	`, pgx.NamedArgs{
+		"id":         id,
+		"old_hash":   oldHash,
+		"new_hash":   newHash,
+		"expires_at": expiresAt,
+	})
+	if err != nil {
+		return infrastructure.ErrInternalDatabase
+	}
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrSessionNotFound
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO session_rotated_tokens(session_id, token_hash)
+		VALUES(@id, @hash)
+		ON CONFLICT DO NOTHING
+	`, pgx.NamedArgs{"id": id, "hash": oldHash})
+	if err != nil {
+		return infrastructure.ErrInternalDatabase
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return infrastructure.ErrInternalDatabase
+	}
+	return nil
+}
+
+func (repo *Repository) WasRotated(ctx context.Context, id string, hash []byte) (bool, error) {
+	var rotated bool
+	err := repo.pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM session_rotated_tokens
+			WHERE session_id = @id AND token_hash = @hash
+		)
+	`, pgx.NamedArgs{"id": id, "hash": hash}).Scan(&rotated)
+	if err != nil {
+		return false, infrastructure.ErrInternalDatabase
+	}
+	return rotated, nil
+}
+
+func (repo *Repository) RevokeSession(ctx context.Context, id string) error {
+	_, err := repo.pool.Exec(ctx, `
+		UPDATE sessions
+		SET revoked_at = now()
+		WHERE id = @id AND revoked_at IS NULL
+	`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return infrastructure.ErrInternalDatabase
+	}
+	return nil
+}
+
+func (repo *Repository) ListSessions(ctx context.Context, username string) ([]entity.Session, error) {
+	rows, err := repo.pool.Query(ctx, `
+		SELECT s.id, s.user_id, u.username, u.role, s.device,
+		       s.created_at, s.last_used_at, s.expires_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE u.username = @username AND s.revoked_at IS NULL AND s.expires_at > now()
+		ORDER BY s.last_used_at DESC
+	`, pgx.NamedArgs{"username": username})
+	if err != nil {
+		return nil, infrastructure.ErrInternalDatabase
+	}
+	defer rows.Close()
+
+	var sessions []entity.Session
+	for rows.Next() {
+		var s entity.Session
+		if err := rows.Scan(
+			&s.ID, &s.UserID, &s.Username, &s.Role, &s.Device,
+			&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt,
+		); err != nil {
+			return nil, infrastructure.ErrInternalDatabase
+		}
+		sessions = append(sessions, s)
+	}
+	if rows.Err() != nil {
+		return nil, infrastructure.ErrInternalDatabase
+	}
+	return sessions, nil
+}
+
+func (repo *Repository) RevokeUserSession(ctx context.Context, username, id string) error {
+	tag, err := repo.pool.Exec(ctx, `
+		UPDATE sessions s
+		SET revoked_at = now()
+		FROM users u
+		WHERE s.id = @id AND u.id = s.user_id AND u.username = @username AND s.revoked_at IS NULL
+	`, pgx.NamedArgs{"id": id, "username": username})
+	if err != nil {
+		return infrastructure.ErrInternalDatabase
+	}
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrSessionNotFound
+	}
+	return nil
+}
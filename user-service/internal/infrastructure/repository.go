@@ -4,15 +4,37 @@ import (
 	"context"
 	"errors"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/entity"
+	"time"
 )
 
 type UserRepository interface {
 	TryCreate(ctx context.Context, user *entity.User) (bool, error)
 	GetUserByUsername(ctx context.Context, username string) (entity.User, error)
+	// SetRole changes the role of username.
+	SetRole(ctx context.Context, username string, role entity.UserRole) error
+}
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, s *entity.Session) error
+	// GetSession returns the session id together with its user, revoked or not.
+	GetSession(ctx context.Context, id string) (entity.Session, error)
+	// RotateSession replaces the token hash of an active session if it is
+	// still oldHash, remembering oldHash as rotated out, and returns
+	// ErrSessionNotFound otherwise.
+	RotateSession(ctx context.Context, id string, oldHash, newHash []byte, expiresAt time.Time) error
+	// WasRotated reports whether hash is the hash of a refresh token of the
+	// session id that has been rotated out.
+	WasRotated(ctx context.Context, id string, hash []byte) (bool, error)
+	RevokeSession(ctx context.Context, id string) error
+	// ListSessions returns the active sessions of username.
+	ListSessions(ctx context.Context, username string) ([]entity.Session, error)
+	// RevokeUserSession revokes the session id if it belongs to username.
+	RevokeUserSession(ctx context.Context, username, id string) error
 }
 
 var (
 	ErrInternalDatabase = errors.New("internal database error")
 	ErrUserNotFound     = errors.New("user not found")
 	ErrUserAlreadyExist = errors.New("user already exist")
+	ErrSessionNotFound  = errors.New("session not found")
 )
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/token"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const maxDeviceLen = 128
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// Login verifies the credentials, opens a session for device and issues an
+// access and a refresh token for it.
+func (u UserService) Login(ctx context.Context, username, password, device string) (Tokens, error) {
+	user, err := u.VerifyUser(ctx, username, password)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	device = strings.TrimSpace(device)
+	if len(device) > maxDeviceLen {
+		device = device[:maxDeviceLen]
+	}
+
+	sess := entity.Session{
+		ID:        newSessionID(),
+		UserID:    user.ID,
+		Device:    device,
+		ExpiresAt: time.Now().Add(u.refreshTTL),
+	}
+	refresh, hash := newRefreshToken(sess.ID)
+	sess.TokenHash = hash
+
+	if err := u.sessions.CreateSession(ctx, &sess); err != nil {
+		u.log.Error("failed to create session", zap.String("username", username), zap.Error(err))
+		return Tokens{}, err
+	}
+
+	u.log.Info("session opened", zap.String("username", username), zap.String("session_id", sess.ID))
+	return u.issue(user.Username, user.Role, sess.ID, refresh, sess.ExpiresAt)
+}
+
+// Refresh exchanges a refresh token for new access and refresh tokens; the
+// presented one stops being valid. Presenting a refresh token that has
+// already been exchanged means it leaked, so the whole session is revoked.
+// Any other token is rejected without touching the session: its id is no
+// secret, so revoking on it would let anyone log the user out.
+func (u UserService) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	sess, hash, err := u.session(ctx, refreshToken)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if subtle.ConstantTimeCompare(sess.TokenHash, hash) != 1 {
+		rotated, err := u.sessions.WasRotated(ctx, sess.ID, hash)
+		if err != nil {
+			u.log.Error("failed to look up rotated token", zap.String("session_id", sess.ID), zap.Error(err))
+			return Tokens{}, err
+		}
+		if !rotated {
+			return Tokens{}, ErrInvalidRefreshToken
+		}
+		return Tokens{}, u.revokeReused(ctx, sess)
+	}
+
+	refresh, newHash := newRefreshToken(sess.ID)
+	expiresAt := time.Now().Add(u.refreshTTL)
+	err = u.sessions.RotateSession(ctx, sess.ID, hash, newHash, expiresAt)
+	if errors.Is(err, infrastructure.ErrSessionNotFound) {
+		// rotated by a concurrent request with the same token
+		return Tokens{}, u.revokeReused(ctx, sess)
+	}
+	if err != nil {
+		u.log.Error("failed to rotate session", zap.String("session_id", sess.ID), zap.Error(err))
+		return Tokens{}, err
+	}
+
+	return u.issue(sess.Username, sess.Role, sess.ID, refresh, expiresAt)
+}
+
+// Logout revokes the session of refreshToken.
+func (u UserService) Logout(ctx context.Context, refreshToken string) error {
+	sess, hash, err := u.session(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(sess.TokenHash, hash) != 1 {
+		return ErrInvalidRefreshToken
+	}
+
+	if err := u.sessions.RevokeSession(ctx, sess.ID); err != nil {
+		u.log.Error("failed to revoke session", zap.String("session_id", sess.ID), zap.Error(err))
+		return err
+	}
+	u.log.Info("session closed", zap.String("username", sess.Username), zap.String("session_id", sess.ID))
+	return nil
+}
+
+// Sessions returns the active sessions of username.
+func (u UserService) Sessions(ctx context.Context, username string) ([]entity.Session, error) {
+	sessions, err := u.sessions.ListSessions(ctx, username)
+	if err != nil {
+		u.log.Error("failed to list sessions", zap.String("username", username), zap.Error(err))
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes the session id of username. Access tokens already
+// issued within it stay valid until they expire.
+func (u UserService) RevokeSession(ctx context.Context, username, id string) error {
+	if err := u.sessions.RevokeUserSession(ctx, username, id); err != nil {
+		if !errors.Is(err, infrastructure.ErrSessionNotFound) {
+			u.log.Error("failed to revoke session", zap.String("session_id", id), zap.Error(err))
+		}
+		return err
+	}
+	u.log.Info("session revoked", zap.String("username", username), zap.String("session_id", id))
+	return nil
+}
+
+// Authenticate verifies an access token and returns its claims.
+func (u UserService) Authenticate(accessToken string) (*token.Claims, error) {
+	return u.issuer.Verify(accessToken)
+}
+
+// session returns the active session of refreshToken and the hash of the
+// token, without checking that it is the current one.
+func (u UserService) session(ctx context.Context, refreshToken string) (entity.Session, []byte, error) {
+	id, hash, ok := parseRefreshToken(refreshToken)
+	if !ok {
+		return entity.Session{}, nil, ErrInvalidRefreshToken
+	}
+
+	sess, err := u.sessions.GetSession(ctx, id)
+	if err != nil {
+		if errors.Is(err, infrastructure.ErrSessionNotFound) {
+			return entity.Session{}, nil, ErrInvalidRefreshToken
+		}
+		u.log.Error("failed to get session", zap.String("session_id", id), zap.Error(err))
+		return entity.Session{}, nil, err
+	}
+	if !sess.Active(time.Now()) {
+		return entity.Session{}, nil, ErrInvalidRefreshToken
+	}
+	return sess, hash, nil
+}
+
+func (u UserService) revokeReused(ctx context.Context, sess entity.Session) error {
+	u.log.Warn("refresh token reuse detected, revoking session",
+		zap.String("username", sess.Username),
+		zap.String("session_id", sess.ID),
+	)
+	if err := u.sessions.RevokeSession(ctx, sess.ID); err != nil {
+		u.log.Error("failed to revoke session", zap.String("session_id", sess.ID), zap.Error(err))
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func (u UserService) issue(username string, role entity.UserRole, sessionID, refresh string, refreshExpiresAt time.Time) (Tokens, error) {
+	access, claims, err := u.issuer.Issue(username, string(role), sessionID)
+	if err != nil {
+		u.log.Error("failed to issue access token", zap.String("username", username), zap.Error(err))
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:      access,
+		ExpiresAt:        claims.ExpiresAt.Time,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: refreshExpiresAt,
+		SessionID:        sessionID,
+		Role:             role,
+	}, nil
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newRefreshToken returns a refresh token for sessionID, of the form
+// "<session id>.<secret>", and the hash of its secret to store.
+func newRefreshToken(sessionID string) (string, []byte) {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	sum := sha256.Sum256(secret)
+	return sessionID + "." + base64.RawURLEncoding.EncodeToString(secret), sum[:]
+}
+
+func parseRefreshToken(t string) (string, []byte, bool) {
+	id, enc, ok := strings.Cut(t, ".")
+	if !ok || id == "" {
+		return "", nil, false
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil || len(secret) != 32 {
+		return "", nil, false
+	}
+	sum := sha256.Sum256(secret)
+	return id, sum[:], true
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/entity"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/token"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type memUsers struct {
+	users map[string]entity.User
+}
+
+func (m *memUsers) TryCreate(_ context.Context, u *entity.User) (bool, error) {
+	if _, ok := m.users[u.Username]; ok {
+		return false, nil
+	}
+	u.ID = int64(len(m.users) + 1)
+	m.users[u.Username] = *u
+	return true, nil
+}
+
+func (m *memUsers) GetUserByUsername(_ context.Context, username string) (entity.User, error) {
+	u, ok := m.users[username]
+	if !ok {
+		return entity.User{}, infrastructure.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (m *memUsers) SetRole(_ context.Context, username string, role entity.UserRole) error {
+	u, ok := m.users[username]
+	if !ok {
+		return infrastructure.ErrUserNotFound
+	}
+	u.Role = role
+	m.users[username] = u
+	return nil
+}
+
+type memSessions struct {
+	mu       sync.Mutex
+	users    *memUsers
+	sessions map[string]entity.Session
+	rotated  map[string][][]byte
+}
+
+func (m *memSessions) CreateSession(_ context.Context, s *entity.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.CreatedAt, s.LastUsedAt = time.Now(), time.Now()
+	m.sessions[s.ID] = *s
+	return nil
+}
+
+func (m *memSessions) GetSession(_ context.Context, id string) (entity.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return entity.Session{}, infrastructure.ErrSessionNotFound
+	}
+	for _, u := range m.users.users {
+		if u.ID == s.UserID {
+			s.Username, s.Role = u.Username, u.Role
+		}
+	}
+	return s, nil
+}
+
+func (m *memSessions) RotateSession(_ context.Context, id string, oldHash, newHash []byte, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || !s.Active(time.Now()) || !bytes.Equal(s.TokenHash, oldHash) {
+		return infrastructure.ErrSessionNotFound
+	}
+	s.TokenHash, s.ExpiresAt = newHash, expiresAt
+	m.sessions[id] = s
+	m.rotated[id] = append(m.rotated[id], oldHash)
+	return nil
+}
+
+func (m *memSessions) WasRotated(_ context.Context, id string, hash []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, h := range m.rotated[id] {
+		if bytes.Equal(h, hash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memSessions) RevokeSession(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[id]; ok && s.RevokedAt == nil {
+		now := time.Now()
+		s.RevokedAt = &now
+		m.sessions[id] = s
+	}
+	return nil
+}
+
+func (m *memSessions) ListSessions(context.Context, string) ([]entity.Session, error) {
+	return nil, nil
+}
+
+func (m *memSessions) RevokeUserSession(context.Context, string, string) error {
+	return nil
+}
+
+func newTestService(t *testing.T) (*UserService, *memSessions) {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &memUsers{users: map[string]entity.User{
+		"alice": {ID: 1, Username: "alice", Password: string(hash), Role: entity.UserRoleUser},
+	}}
+	sessions := &memSessions{users: users, sessions: map[string]entity.Session{}, rotated: map[string][][]byte{}}
+
+	keys, err := token.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := token.NewIssuer(keys, "user-service", time.Minute)
+	return NewUserService(users, sessions, zap.NewNop(), issuer, time.Hour), sessions
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// present returns the refresh token to present, given the tokens
+		// of the login and of one refresh after it.
+		present   func(login, refreshed Tokens) string
+		wantErr   error
+		wantAlive bool
+	}{
+		{
+			name:      "current token",
+			present:   func(_, refreshed Tokens) string { return refreshed.RefreshToken },
+			wantAlive: true,
+		},
+		{
+			name:      "rotated out token is reuse",
+			present:   func(login, _ Tokens) string { return login.RefreshToken },
+			wantErr:   ErrRefreshTokenReused,
+			wantAlive: false,
+		},
+		{
+			name: "forged secret with known session id",
+			present: func(login, _ Tokens) string {
+				return login.SessionID + ".AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+			},
+			wantErr:   ErrInvalidRefreshToken,
+			wantAlive: true,
+		},
+		{
+			name:      "malformed token",
+			present:   func(login, _ Tokens) string { return login.SessionID + ".garbage" },
+			wantErr:   ErrInvalidRefreshToken,
+			wantAlive: true,
+		},
+		{
+			name: "unknown session",
+			present: func(_, refreshed Tokens) string {
+				_, secret, _ := strings.Cut(refreshed.RefreshToken, ".")
+				return "unknown." + secret
+			},
+			wantErr:   ErrInvalidRefreshToken,
+			wantAlive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, sessions := newTestService(t)
+
+			login, err := svc.Login(ctx, "alice", "secret", "test")
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+			refreshed, err := svc.Refresh(ctx, login.RefreshToken)
+			if err != nil {
+				t.Fatalf("first refresh: %v", err)
+			}
+			if refreshed.SessionID != login.SessionID || refreshed.RefreshToken == login.RefreshToken {
+				t.Fatalf("refresh did not rotate the token within the session")
+			}
+
+			_, err = svc.Refresh(ctx, tt.present(login, refreshed))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("refresh error = %v, want %v", err, tt.wantErr)
+			}
+
+			sess, _ := sessions.GetSession(ctx, login.SessionID)
+			if alive := sess.Active(time.Now()); alive != tt.wantAlive {
+				t.Fatalf("session active = %v, want %v", alive, tt.wantAlive)
+			}
+		})
+	}
+}
+
+func TestRefreshAfterReuseRevokesCurrentToken(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+
+	login, err := svc.Login(ctx, "alice", "secret", "test")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	refreshed, err := svc.Refresh(ctx, login.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := svc.Refresh(ctx, login.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if _, err := svc.Refresh(ctx, refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("refresh after reuse error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
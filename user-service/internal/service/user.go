@@ -5,30 +5,55 @@ import (
 	"errors"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/entity"
 	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/infrastructure"
+	"github.com/dunooo0ooo/wb-tech-l0/user-service/internal/token"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"time"
 )
 
 type UserService struct {
-	repo infrastructure.UserRepository
-	log  *zap.Logger
+	repo       infrastructure.UserRepository
+	sessions   infrastructure.SessionRepository
+	log        *zap.Logger
+	issuer     *token.Issuer
+	refreshTTL time.Duration
 }
 
-func NewUserService(repo infrastructure.UserRepository, logger *zap.Logger) *UserService {
-	return &UserService{repo: repo, log: logger}
+func NewUserService(repo infrastructure.UserRepository, sessions infrastructure.SessionRepository, logger *zap.Logger, issuer *token.Issuer, refreshTTL time.Duration) *UserService {
+	if refreshTTL <= 0 {
+		refreshTTL = 30 * 24 * time.Hour
+	}
+	return &UserService{repo: repo, sessions: sessions, log: logger, issuer: issuer, refreshTTL: refreshTTL}
 }
 
 const EmptyString = ""
 
 var (
-	ErrInvalidArguments = errors.New("invalid arguments")
+	ErrInvalidArguments   = errors.New("invalid arguments")
+	ErrInvalidCredentials = errors.New("invalid credentials")
 )
 
-func (u UserService) TryCreate(ctx context.Context, username, password, role string) (bool, error) {
-	if username == EmptyString || password == EmptyString || role == EmptyString {
+// Tokens are issued to a user that logged in or refreshed a session.
+type Tokens struct {
+	AccessToken      string
+	ExpiresAt        time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	SessionID        string
+	Role             entity.UserRole
+}
+
+// TryCreate creates a user with role. Callers must make sure whoever asks
+// for the user may grant the role.
+func (u UserService) TryCreate(ctx context.Context, username, password string, role entity.UserRole) (bool, error) {
+	if username == EmptyString || password == EmptyString {
 		u.log.Error("empty arguments")
 		return false, ErrInvalidArguments
 	}
+	if !role.Valid() {
+		u.log.Error("unknown role", zap.String("role", string(role)))
+		return false, ErrInvalidArguments
+	}
 
 	pass, err := hashPassword(password)
 	if err != nil {
@@ -39,7 +64,7 @@ func (u UserService) TryCreate(ctx context.Context, username, password, role str
 	user := entity.User{
 		Username: username,
 		Password: pass,
-		Role:     entity.UserRole(role),
+		Role:     role,
 	}
 
 	res, err := u.repo.TryCreate(ctx, &user)
@@ -52,6 +77,23 @@ func (u UserService) TryCreate(ctx context.Context, username, password, role str
 	return res, nil
 }
 
+// SetRole changes the role of username. Sessions that are already open get
+// the new role with their next refresh.
+func (u UserService) SetRole(ctx context.Context, username string, role entity.UserRole) error {
+	if username == EmptyString || !role.Valid() {
+		u.log.Error("invalid arguments", zap.String("username", username), zap.String("role", string(role)))
+		return ErrInvalidArguments
+	}
+
+	if err := u.repo.SetRole(ctx, username, role); err != nil {
+		u.log.Error("failed to set role", zap.String("username", username), zap.Error(err))
+		return err
+	}
+
+	u.log.Info("role changed", zap.String("username", username), zap.String("role", string(role)))
+	return nil
+}
+
 func (u UserService) VerifyUser(ctx context.Context, username, password string) (entity.User, error) {
 	if username == EmptyString || password == EmptyString {
 		u.log.Error("empty arguments")
@@ -67,12 +109,17 @@ func (u UserService) VerifyUser(ctx context.Context, username, password string)
 	res := checkPassword(user.Password, password)
 	if !res {
 		u.log.Error("invalid password", zap.String("username", username))
-		return entity.User{}, ErrInvalidArguments
+		return entity.User{}, ErrInvalidCredentials
 	}
 	u.log.Info("successfully verified user", zap.String("username", username))
 	return user, nil
 }
 
+// JWKS returns the public keys access tokens can be verified with.
+func (u UserService) JWKS() token.JWKS {
+	return u.issuer.Keys().JWKS()
+}
+
 func hashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
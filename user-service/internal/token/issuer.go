@@ -0,0 +1,91 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of an access token.
+type Claims struct {
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Issuer signs access tokens with the signing key of its key set.
+type Issuer struct {
+	keys   *KeySet
+	issuer string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewIssuer(keys *KeySet, issuer string, ttl time.Duration) *Issuer {
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	return &Issuer{keys: keys, issuer: issuer, ttl: ttl, now: time.Now}
+}
+
+// Issue returns a signed access token for subject with role, issued within
+// session sessionID, and its claims.
+func (i *Issuer) Issue(subject, role, sessionID string) (string, *Claims, error) {
+	now := i.now()
+	claims := &Claims{
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.issuer,
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.ttl)),
+			ID:        newTokenID(),
+		},
+	}
+
+	key := i.keys.Signing()
+	tok := jwt.NewWithClaims(key.method, claims)
+	tok.Header["kid"] = key.ID
+
+	signed, err := tok.SignedString(key.signer)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// Verify checks the signature, issuer and expiry of an access token issued
+// with any key of the set and returns its claims.
+func (i *Issuer) Verify(s string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(s, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := i.keys.Key(kid)
+		if !ok || key.method.Alg() != t.Method.Alg() {
+			return nil, ErrUnknownKey
+		}
+		return key.signer.Public(), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(i.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(i.now),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (i *Issuer) Keys() *KeySet {
+	return i.keys
+}
+
+func newTokenID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
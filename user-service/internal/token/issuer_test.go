@@ -0,0 +1,93 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T, id string, rsaKey bool) *Key {
+	t.Helper()
+	var signer crypto.Signer
+	var err error
+	if rsaKey {
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewKey(id, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestIssuerKeyRotation(t *testing.T) {
+	old, cur, other := newKey(t, "2026-01", true), newKey(t, "2026-10", false), newKey(t, "other", false)
+
+	tests := []struct {
+		name string
+		// signedBy is the key set the token is issued with, verifiedBy the
+		// one it is verified with after rotation.
+		signedBy   []*Key
+		verifiedBy []*Key
+		wantErr    bool
+	}{
+		{"same set", []*Key{old}, []*Key{old}, false},
+		{"old key kept after rotation", []*Key{old}, []*Key{old, cur}, false},
+		{"new key", []*Key{old, cur}, []*Key{old, cur}, false},
+		{"old key removed", []*Key{old}, []*Key{cur}, true},
+		{"same kid, other key", []*Key{{ID: cur.ID, signer: other.signer, method: other.method}}, []*Key{cur}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signing, err := NewKeySet(tt.signedBy, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifying, err := NewKeySet(tt.verifiedBy, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tok, _, err := NewIssuer(signing, "user-service", time.Minute).Issue("alice", "user", "sid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := NewIssuer(verifying, "user-service", time.Minute).Verify(tok)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verify error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.Subject != "alice" || claims.SessionID != "sid") {
+				t.Fatalf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestKeySetSigningKey(t *testing.T) {
+	a, b := newKey(t, "a", false), newKey(t, "b", false)
+
+	ks, err := NewKeySet([]*Key{b, a}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Signing().ID != "b" {
+		t.Fatalf("signing kid = %q, want the last kid %q", ks.Signing().ID, "b")
+	}
+
+	if ks, err = NewKeySet([]*Key{a, b}, "a"); err != nil || ks.Signing().ID != "a" {
+		t.Fatalf("signing kid = %v, %v, want %q", ks, err, "a")
+	}
+	if _, err := NewKeySet([]*Key{a}, "missing"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("error = %v, want %v", err, ErrUnknownKey)
+	}
+}
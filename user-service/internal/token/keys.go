@@ -0,0 +1,190 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a private key used to sign tokens, identified by its kid.
+type Key struct {
+	ID     string
+	signer crypto.Signer
+	method jwt.SigningMethod
+}
+
+// NewKey wraps an RSA or Ed25519 private key.
+func NewKey(id string, signer crypto.Signer) (*Key, error) {
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, signer: signer, method: jwt.SigningMethodRS256}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, signer: signer, method: jwt.SigningMethodEdDSA}, nil
+	default:
+		return nil, fmt.Errorf("key %q: unsupported key type %T", id, signer)
+	}
+}
+
+// KeySet holds all keys whose tokens are accepted and the one new tokens are
+// signed with. Rotating keys means adding a new key, making it the signing
+// key and removing the old one once the tokens it signed have expired.
+type KeySet struct {
+	keys    []*Key
+	signing *Key
+}
+
+// NewKeySet returns a set signing with the key signingKID, or with the last
+// key by kid if signingKID is empty.
+func NewKeySet(keys []*Key, signingKID string) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+
+	keys = append([]*Key(nil), keys...)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	ks := &KeySet{keys: keys, signing: keys[len(keys)-1]}
+	if signingKID != "" {
+		k, ok := ks.Key(signingKID)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, signingKID)
+		}
+		ks.signing = k
+	}
+	return ks, nil
+}
+
+// LoadKeys reads every *.pem file in dir as a private key whose kid is the
+// file name without the extension.
+func LoadKeys(dir, signingKID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*Key, 0, len(files))
+	for _, f := range files {
+		k, err := readKey(f)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return NewKeySet(keys, signingKID)
+}
+
+// GenerateKeys returns a set with a single new Ed25519 key. Tokens signed
+// with it do not survive a restart, so it is only meant for development.
+func GenerateKeys() (*KeySet, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	k, err := NewKey("ephemeral", priv)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet([]*Key{k}, "")
+}
+
+func readKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %q: no PEM block", id)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", id, err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key %q: unsupported key type %T", id, parsed)
+	}
+	return NewKey(id, signer)
+}
+
+func (ks *KeySet) Key(kid string) (*Key, bool) {
+	for _, k := range ks.keys {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+func (ks *KeySet) Signing() *Key {
+	return ks.signing
+}
+
+// JWK is the public part of a key as published in the JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.signer.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = b64(pub.N.Bytes())
+			jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = b64(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 type HTTPConfig struct {
@@ -21,10 +22,29 @@ type LoggerConfig struct {
 	Level string
 }
 
+type JWTConfig struct {
+	// KeysDir holds the signing keys as <kid>.pem files; when empty an
+	// ephemeral key is generated.
+	KeysDir    string
+	SigningKID string
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// AdminConfig names an admin that is created at startup unless a user with
+// that name exists, since signing up only creates users.
+type AdminConfig struct {
+	Username string
+	Password string
+}
+
 type Config struct {
 	HTTP     HTTPConfig
 	Postgres PostgresConfig
 	Logger   LoggerConfig
+	JWT      JWTConfig
+	Admin    AdminConfig
 }
 
 func getenv(key, def string) string {
@@ -59,6 +79,17 @@ func Load() Config {
 		Logger: LoggerConfig{
 			Level: getenv("LOG_LEVEL", "info"),
 		},
+		JWT: JWTConfig{
+			KeysDir:    getenv("JWT_KEYS_DIR", ""),
+			SigningKID: getenv("JWT_SIGNING_KID", ""),
+			Issuer:     getenv("JWT_ISSUER", "user-service"),
+			AccessTTL:  time.Duration(getenvInt("JWT_ACCESS_TTL_SEC", 900)) * time.Second,
+			RefreshTTL: time.Duration(getenvInt("JWT_REFRESH_TTL_SEC", 30*24*3600)) * time.Second,
+		},
+		Admin: AdminConfig{
+			Username: getenv("ADMIN_USERNAME", ""),
+			Password: getenv("ADMIN_PASSWORD", ""),
+		},
 	}
 }
 